@@ -1,7 +1,7 @@
 package main
 
 import (
-	"os"
+	"context"
 	"os/signal"
 	"syscall"
 
@@ -25,13 +25,17 @@ func main() {
 	}
 	log.Debug().Interface("config", cfg).Msg("agent config")
 
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc,
+	ctx, stop := signal.NotifyContext(context.Background(),
 		syscall.SIGTERM,
 		syscall.SIGINT,
 		syscall.SIGQUIT)
+	defer stop()
 
-	agent := metricsagent.New(cfg)
-	agent.Start()
-	<-sigc
+	agent, err := metricsagent.New(cfg)
+	if err != nil {
+		log.Panic().Err(err).Stack().Msg("can't create agent")
+	}
+	agent.Run(ctx)
+
+	log.Info().Msg("agent stopped")
 }
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
@@ -14,6 +19,7 @@ import (
 func main() {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	zerolog.DefaultContextLogger = &log.Logger
 
 	cfg, err := config.BuildConfig()
 	if err != nil {
@@ -23,16 +29,32 @@ func main() {
 
 	myStorage, err := storage.New(cfg)
 	if err != nil {
-		if err.Error() != `can't create database'` {
-			log.Error().Err(err).Stack()
-		}
-		log.Info().Msg(`can't create database; fallback to inmemory storage`)
-		myStorage = storage.NewForcedInMemory(cfg)
+		log.Panic().Err(err).Stack().Msg("can't create storage")
 	}
 
 	serv := service.New(cfg.Key, myStorage)
 
-	myapi := api.New(serv)
+	myapi := api.New(serv, cfg.ShutdownTimeout)
+
+	ctx, stop := signal.NotifyContext(context.Background(),
+		syscall.SIGTERM,
+		syscall.SIGINT,
+		syscall.SIGQUIT)
+
+	exitCode := 0
+	err = myapi.Run(ctx, cfg.Address)
+	stop()
+	if err != nil {
+		log.Error().Err(err).Stack().Msg("server stopped with error")
+		exitCode = 1
+	}
+
+	err = myStorage.Close()
+	if err != nil {
+		log.Error().Err(err).Stack().Msg("can't close storage")
+		exitCode = 1
+	}
 
-	log.Panic().Err(myapi.Run(cfg.Address))
+	log.Info().Int("code", exitCode).Msg("server exited")
+	os.Exit(exitCode)
 }
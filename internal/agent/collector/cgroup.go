@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cgroupV1Unlimited is the least value cgroup v1 reports as a limit when
+// there is no limit: the max int64 rounded down to the page size.
+const cgroupV1Unlimited = 1 << 62
+
+var ErrNoCgroup = errors.New("no cgroup files found")
+
+// cgroupCollector reads memory, CPU and pids usage and limits of the cgroup
+// mounted at the root, i.e. of the container the agent runs in. Both cgroup
+// v2 (the unified hierarchy) and v1 (a hierarchy per controller) are read.
+// Metrics of controllers which aren't available are skipped, limits are
+// skipped when there is no limit.
+type cgroupCollector struct {
+	root string
+
+	mu     sync.Mutex
+	deltas *counterDeltas
+}
+
+func newCgroupCollector(root string) *cgroupCollector {
+	return &cgroupCollector{root: root, deltas: newCounterDeltas()}
+}
+
+func (c *cgroupCollector) Name() string {
+	return CgroupCollector
+}
+
+func (c *cgroupCollector) Collect(ctx context.Context) ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res []Sample
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		res = c.collectV2()
+	} else {
+		res = c.collectV1()
+	}
+
+	if len(res) == 0 {
+		return nil, ErrNoCgroup
+	}
+	return res, nil
+}
+
+func (c *cgroupCollector) collectV2() []Sample {
+	var res []Sample
+	if usage, ok := c.readUint("memory.current"); ok {
+		res = append(res, Gauge("CgroupMemoryUsage", float64(usage)))
+	}
+	if limit, ok := c.readUint("memory.max"); ok {
+		res = append(res, Gauge("CgroupMemoryLimit", float64(limit)))
+	}
+
+	if fields, err := c.readFields("cpu.max"); err == nil && len(fields) == 2 {
+		quota, errQuota := strconv.ParseFloat(fields[0], 64)
+		period, errPeriod := strconv.ParseFloat(fields[1], 64)
+		if errQuota == nil && errPeriod == nil && period > 0 {
+			res = append(res, Gauge("CgroupCPULimit", quota/period))
+		}
+	}
+	if stat, err := c.readStat("cpu.stat"); err == nil {
+		res = append(res, c.cpuCounters(stat["usage_usec"], stat["nr_periods"], stat["nr_throttled"], stat["throttled_usec"])...)
+	}
+
+	if current, ok := c.readUint("pids.current"); ok {
+		res = append(res, Gauge("CgroupPids", float64(current)))
+	}
+	if limit, ok := c.readUint("pids.max"); ok {
+		res = append(res, Gauge("CgroupPidsLimit", float64(limit)))
+	}
+	return res
+}
+
+func (c *cgroupCollector) collectV1() []Sample {
+	var res []Sample
+	if usage, ok := c.readUint("memory/memory.usage_in_bytes"); ok {
+		res = append(res, Gauge("CgroupMemoryUsage", float64(usage)))
+	}
+	if limit, ok := c.readUint("memory/memory.limit_in_bytes"); ok && limit < cgroupV1Unlimited {
+		res = append(res, Gauge("CgroupMemoryLimit", float64(limit)))
+	}
+
+	quota, okQuota := c.readInt("cpu/cpu.cfs_quota_us")
+	period, okPeriod := c.readInt("cpu/cpu.cfs_period_us")
+	if okQuota && okPeriod && quota > 0 && period > 0 {
+		res = append(res, Gauge("CgroupCPULimit", float64(quota)/float64(period)))
+	}
+	// cgroup v1 reports CPU times in nanoseconds.
+	usage, okUsage := c.readUint("cpuacct/cpuacct.usage")
+	if stat, err := c.readStat("cpu/cpu.stat"); err == nil && okUsage {
+		res = append(res, c.cpuCounters(usage/1000, stat["nr_periods"], stat["nr_throttled"], stat["throttled_time"]/1000)...)
+	}
+
+	if current, ok := c.readUint("pids/pids.current"); ok {
+		res = append(res, Gauge("CgroupPids", float64(current)))
+	}
+	if limit, ok := c.readUint("pids/pids.max"); ok {
+		res = append(res, Gauge("CgroupPidsLimit", float64(limit)))
+	}
+	return res
+}
+
+// cpuCounters returns CPU usage and throttling of the cgroup, times are in
+// microseconds.
+func (c *cgroupCollector) cpuCounters(usage, periods, throttledPeriods, throttledTime uint64) []Sample {
+	return []Sample{
+		c.deltas.sample("CgroupCPUUsageUsec", usage),
+		c.deltas.sample("CgroupCPUPeriods", periods),
+		c.deltas.sample("CgroupCPUThrottledPeriods", throttledPeriods),
+		c.deltas.sample("CgroupCPUThrottledUsec", throttledTime),
+	}
+}
+
+func (c *cgroupCollector) readFields(name string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(c.root, name))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// readUint reads the file with a single number. Files containing "max",
+// which means there is no limit, are reported as missing.
+func (c *cgroupCollector) readUint(name string) (uint64, bool) {
+	fields, err := c.readFields(name)
+	if err != nil || len(fields) != 1 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(fields[0], 10, 64)
+	return value, err == nil
+}
+
+func (c *cgroupCollector) readInt(name string) (int64, bool) {
+	fields, err := c.readFields(name)
+	if err != nil || len(fields) != 1 {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(fields[0], 10, 64)
+	return value, err == nil
+}
+
+// readStat reads the file of "key value" lines.
+func (c *cgroupCollector) readStat(name string) (map[string]uint64, error) {
+	file, err := os.Open(filepath.Join(c.root, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	res := map[string]uint64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		res[fields[0]] = value
+	}
+	return res, scanner.Err()
+}
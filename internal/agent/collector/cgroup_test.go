@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+}
+
+func Test_cgroupCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		update map[string]string
+		first  []Sample
+		second []Sample
+	}{
+		{
+			name: "v2",
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory pids\n",
+				"memory.current":     "1048576\n",
+				"memory.max":         "2097152\n",
+				"cpu.max":            "50000 100000\n",
+				"cpu.stat":           "usage_usec 1000\nuser_usec 600\nsystem_usec 400\nnr_periods 10\nnr_throttled 2\nthrottled_usec 300\n",
+				"pids.current":       "7\n",
+				"pids.max":           "max\n",
+			},
+			update: map[string]string{
+				"cpu.stat": "usage_usec 1500\nuser_usec 900\nsystem_usec 600\nnr_periods 15\nnr_throttled 3\nthrottled_usec 400\n",
+			},
+			first: []Sample{
+				Gauge("CgroupMemoryUsage", 1048576),
+				Gauge("CgroupMemoryLimit", 2097152),
+				Gauge("CgroupCPULimit", 0.5),
+				Counter("CgroupCPUUsageUsec", 0),
+				Counter("CgroupCPUPeriods", 0),
+				Counter("CgroupCPUThrottledPeriods", 0),
+				Counter("CgroupCPUThrottledUsec", 0),
+				Gauge("CgroupPids", 7),
+			},
+			second: []Sample{
+				Gauge("CgroupMemoryUsage", 1048576),
+				Gauge("CgroupMemoryLimit", 2097152),
+				Gauge("CgroupCPULimit", 0.5),
+				Counter("CgroupCPUUsageUsec", 500),
+				Counter("CgroupCPUPeriods", 5),
+				Counter("CgroupCPUThrottledPeriods", 1),
+				Counter("CgroupCPUThrottledUsec", 100),
+				Gauge("CgroupPids", 7),
+			},
+		},
+		{
+			name: "v1",
+			files: map[string]string{
+				"memory/memory.usage_in_bytes": "1048576\n",
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+				"cpu/cpu.cfs_quota_us":         "200000\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"cpu/cpu.stat":                 "nr_periods 10\nnr_throttled 2\nthrottled_time 300000\n",
+				"cpuacct/cpuacct.usage":        "1000000\n",
+				"pids/pids.current":            "7\n",
+				"pids/pids.max":                "100\n",
+			},
+			update: map[string]string{
+				"cpu/cpu.stat":          "nr_periods 15\nnr_throttled 3\nthrottled_time 400000\n",
+				"cpuacct/cpuacct.usage": "1500000\n",
+			},
+			first: []Sample{
+				Gauge("CgroupMemoryUsage", 1048576),
+				Gauge("CgroupCPULimit", 2),
+				Counter("CgroupCPUUsageUsec", 0),
+				Counter("CgroupCPUPeriods", 0),
+				Counter("CgroupCPUThrottledPeriods", 0),
+				Counter("CgroupCPUThrottledUsec", 0),
+				Gauge("CgroupPids", 7),
+				Gauge("CgroupPidsLimit", 100),
+			},
+			second: []Sample{
+				Gauge("CgroupMemoryUsage", 1048576),
+				Gauge("CgroupCPULimit", 2),
+				Counter("CgroupCPUUsageUsec", 500),
+				Counter("CgroupCPUPeriods", 5),
+				Counter("CgroupCPUThrottledPeriods", 1),
+				Counter("CgroupCPUThrottledUsec", 100),
+				Gauge("CgroupPids", 7),
+				Gauge("CgroupPidsLimit", 100),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			c := newCgroupCollector(root)
+
+			samples, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.first, samples)
+
+			writeFiles(t, root, tt.update)
+			samples, err = c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.second, samples)
+		})
+	}
+}
+
+func Test_cgroupCollector_NoCgroup(t *testing.T) {
+	c := newCgroupCollector(t.TempDir())
+	_, err := c.Collect(context.Background())
+	assert.ErrorIs(t, err, ErrNoCgroup)
+}
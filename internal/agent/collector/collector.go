@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	gauge   = "gauge"
+	counter = "counter"
+)
+
+// Sample is the value of the metric read by the collector. Gauges replace
+// the previous value, counters are increments since the previous collect.
+type Sample struct {
+	Name  string
+	MType string
+	Value float64
+	Delta int64
+}
+
+func Gauge(name string, value float64) Sample {
+	return Sample{Name: name, MType: gauge, Value: value}
+}
+
+func Counter(name string, delta int64) Sample {
+	return Sample{Name: name, MType: counter, Delta: delta}
+}
+
+// IsCounter reports whether the sample is an increment of the counter.
+func (s Sample) IsCounter() bool {
+	return s.MType == counter
+}
+
+// Collector reads a group of metrics. Collect returns samples read so far
+// along with the error, so one failed source doesn't hide others.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]Sample, error)
+}
+
+// Scheduled is implemented by collectors which have their own poll interval,
+// e.g. set in their config. The interval set in the agent config for the
+// collector takes precedence.
+type Scheduled interface {
+	Interval() time.Duration
+}
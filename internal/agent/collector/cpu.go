@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// cpuCollector reads utilization of every core as CPUutilization1..N and
+// the share of user, system and iowait time of all cores, in percents since
+// the previous collect or since boot on the first one.
+type cpuCollector struct {
+	times func(ctx context.Context, perCPU bool) ([]cpu.TimesStat, error)
+
+	mu      sync.Mutex
+	prevAll cpu.TimesStat
+	prevPer []cpu.TimesStat
+}
+
+func newCPUCollector() *cpuCollector {
+	return &cpuCollector{times: cpu.TimesWithContext}
+}
+
+func (c *cpuCollector) Name() string {
+	return CPUCollector
+}
+
+func (c *cpuCollector) Collect(ctx context.Context) ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res []Sample
+
+	perCPU, err := c.times(ctx, true)
+	if err != nil {
+		return res, err
+	}
+	for i, cur := range perCPU {
+		var prev cpu.TimesStat
+		if i < len(c.prevPer) {
+			prev = c.prevPer[i]
+		}
+		total := cur.Total() - prev.Total()
+		idle := cur.Idle + cur.Iowait - prev.Idle - prev.Iowait
+		res = append(res, Gauge(fmt.Sprintf("CPUutilization%d", i+1), percent(total-idle, total)))
+	}
+	c.prevPer = perCPU
+
+	all, err := c.times(ctx, false)
+	if err != nil {
+		return res, err
+	}
+	if len(all) > 0 {
+		cur, prev := all[0], c.prevAll
+		total := cur.Total() - prev.Total()
+		res = append(res,
+			Gauge("CPUUser", percent(cur.User-prev.User, total)),
+			Gauge("CPUSystem", percent(cur.System-prev.System, total)),
+			Gauge("CPUIowait", percent(cur.Iowait-prev.Iowait, total)),
+		)
+		c.prevAll = cur
+	}
+
+	return res, nil
+}
+
+func percent(part, total float64) float64 {
+	if total <= 0 || part <= 0 {
+		return 0
+	}
+	if part > total {
+		return 100
+	}
+	return part / total * 100
+}
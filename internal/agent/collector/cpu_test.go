@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_cpuCollector_Collect(t *testing.T) {
+	perCPU := []cpu.TimesStat{
+		{CPU: "cpu0", User: 10, System: 10, Idle: 80},
+		{CPU: "cpu1", User: 40, Idle: 50, Iowait: 10},
+	}
+	c := &cpuCollector{times: func(ctx context.Context, perCPUTimes bool) ([]cpu.TimesStat, error) {
+		if perCPUTimes {
+			return perCPU, nil
+		}
+		var all cpu.TimesStat
+		for _, times := range perCPU {
+			all.User += times.User
+			all.System += times.System
+			all.Idle += times.Idle
+			all.Iowait += times.Iowait
+		}
+		return []cpu.TimesStat{all}, nil
+	}}
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Gauge("CPUutilization1", 20),
+		Gauge("CPUutilization2", 40),
+		Gauge("CPUUser", 25),
+		Gauge("CPUSystem", 5),
+		Gauge("CPUIowait", 5),
+	}, samples)
+
+	// The second collect reports utilization since the first one.
+	perCPU = []cpu.TimesStat{
+		{CPU: "cpu0", User: 10, System: 10, Idle: 180},
+		{CPU: "cpu1", User: 140, Idle: 50, Iowait: 10},
+	}
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Gauge("CPUutilization1", 0),
+		Gauge("CPUutilization2", 100),
+		Gauge("CPUUser", 50),
+		Gauge("CPUSystem", 0),
+		Gauge("CPUIowait", 0),
+	}, samples)
+}
+
+func Test_hostCollectors(t *testing.T) {
+	for _, c := range []Collector{newCPUCollector(), &loadCollector{}, &uptimeCollector{}} {
+		t.Run(c.Name(), func(t *testing.T) {
+			samples, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.NotEmpty(t, samples)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskCollector reads space and inode usage of every mounted filesystem.
+// Without included types only filesystems backed by devices are read.
+type diskCollector struct {
+	include map[string]bool
+	exclude map[string]bool
+
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+}
+
+func newDiskCollector(include, exclude string) *diskCollector {
+	return &diskCollector{
+		include:    toSet(splitList(include)),
+		exclude:    toSet(splitList(exclude)),
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+	}
+}
+
+func (c *diskCollector) Name() string {
+	return DiskCollector
+}
+
+func (c *diskCollector) Collect(ctx context.Context) ([]Sample, error) {
+	partitions, err := c.partitions(ctx, len(c.include) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Sample
+	seen := map[string]bool{}
+	for _, partition := range partitions {
+		if !c.accepts(partition.Fstype) || seen[partition.Mountpoint] {
+			continue
+		}
+		seen[partition.Mountpoint] = true
+
+		usage, err := c.usage(ctx, partition.Mountpoint)
+		if err != nil {
+			// Filesystems may be unmounted or inaccessible, others still count.
+			continue
+		}
+		res = append(res,
+			Gauge(withLabel("DiskTotal", partition.Mountpoint), float64(usage.Total)),
+			Gauge(withLabel("DiskUsed", partition.Mountpoint), float64(usage.Used)),
+			Gauge(withLabel("DiskFree", partition.Mountpoint), float64(usage.Free)),
+			Gauge(withLabel("DiskInodesTotal", partition.Mountpoint), float64(usage.InodesTotal)),
+			Gauge(withLabel("DiskInodesUsed", partition.Mountpoint), float64(usage.InodesUsed)),
+			Gauge(withLabel("DiskInodesFree", partition.Mountpoint), float64(usage.InodesFree)),
+		)
+	}
+	return res, nil
+}
+
+func (c *diskCollector) accepts(fstype string) bool {
+	if len(c.include) > 0 && !c.include[fstype] {
+		return false
+	}
+	return !c.exclude[fstype]
+}
+
+// diskIOCollector reads bytes and operations read and written by every
+// block device as counters.
+type diskIOCollector struct {
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+
+	mu     sync.Mutex
+	deltas *counterDeltas
+}
+
+func newDiskIOCollector() *diskIOCollector {
+	return &diskIOCollector{
+		ioCounters: disk.IOCountersWithContext,
+		deltas:     newCounterDeltas(),
+	}
+}
+
+func (c *diskIOCollector) Name() string {
+	return DiskIOCollector
+}
+
+func (c *diskIOCollector) Collect(ctx context.Context) ([]Sample, error) {
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res []Sample
+	for _, name := range names {
+		stat := counters[name]
+		res = append(res,
+			c.deltas.sample(withLabel("DiskReadBytes", name), stat.ReadBytes),
+			c.deltas.sample(withLabel("DiskWriteBytes", name), stat.WriteBytes),
+			c.deltas.sample(withLabel("DiskReadCount", name), stat.ReadCount),
+			c.deltas.sample(withLabel("DiskWriteCount", name), stat.WriteCount),
+		)
+	}
+	return res, nil
+}
+
+func toSet(items []string) map[string]bool {
+	res := map[string]bool{}
+	for _, item := range items {
+		res[item] = true
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_diskCollector_Collect(t *testing.T) {
+	partitions := []disk.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+		{Device: "overlay", Mountpoint: "/var/lib/docker", Fstype: "overlay"},
+	}
+	tests := []struct {
+		name        string
+		include     string
+		exclude     string
+		wantAll     bool
+		mountpoints []string
+	}{
+		{
+			name:        "exclude",
+			exclude:     "tmpfs,overlay",
+			mountpoints: []string{"/"},
+		},
+		{
+			name:        "include",
+			include:     "ext4,tmpfs",
+			wantAll:     true,
+			mountpoints: []string{"/", "/run"},
+		},
+		{
+			name:        "include and exclude",
+			include:     "ext4,tmpfs",
+			exclude:     "tmpfs",
+			wantAll:     true,
+			mountpoints: []string{"/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newDiskCollector(tt.include, tt.exclude)
+			c.partitions = func(ctx context.Context, all bool) ([]disk.PartitionStat, error) {
+				assert.Equal(t, tt.wantAll, all)
+				return partitions, nil
+			}
+			c.usage = func(ctx context.Context, path string) (*disk.UsageStat, error) {
+				return &disk.UsageStat{Path: path, Total: 100, Used: 30, Free: 70, InodesTotal: 10, InodesUsed: 4, InodesFree: 6}, nil
+			}
+
+			samples, err := c.Collect(context.Background())
+			require.NoError(t, err)
+
+			var want []Sample
+			for _, mountpoint := range tt.mountpoints {
+				want = append(want,
+					Gauge("DiskTotal:"+mountpoint, 100),
+					Gauge("DiskUsed:"+mountpoint, 30),
+					Gauge("DiskFree:"+mountpoint, 70),
+					Gauge("DiskInodesTotal:"+mountpoint, 10),
+					Gauge("DiskInodesUsed:"+mountpoint, 4),
+					Gauge("DiskInodesFree:"+mountpoint, 6),
+				)
+			}
+			assert.Equal(t, want, samples)
+		})
+	}
+}
+
+func Test_diskIOCollector_Collect(t *testing.T) {
+	counters := map[string]disk.IOCountersStat{
+		"sda": {ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20},
+	}
+	c := newDiskIOCollector()
+	c.ioCounters = func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+		return counters, nil
+	}
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Counter("DiskReadBytes:sda", 0),
+		Counter("DiskWriteBytes:sda", 0),
+		Counter("DiskReadCount:sda", 0),
+		Counter("DiskWriteCount:sda", 0),
+	}, samples)
+
+	counters["sda"] = disk.IOCountersStat{ReadBytes: 1500, WriteBytes: 2000, ReadCount: 15, WriteCount: 3}
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Counter("DiskReadBytes:sda", 500),
+		Counter("DiskWriteBytes:sda", 0),
+		Counter("DiskReadCount:sda", 5),
+		Counter("DiskWriteCount:sda", 3),
+	}, samples)
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+// defaultExecTimeout limits scripts which don't set their own timeout.
+const defaultExecTimeout = 10 * time.Second
+
+var (
+	ErrNoExecConfig    = errors.New("exec config isn't set")
+	ErrWrongExecConfig = errors.New("wrong exec config")
+	ErrWrongOutput     = errors.New("wrong script output")
+)
+
+// duration is time.Duration written in JSON as a string, e.g. "30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(value)
+	return nil
+}
+
+// execScript is the command the exec collector runs, as it's listed in the
+// exec config file.
+type execScript struct {
+	Name     string   `json:"name"`
+	Command  []string `json:"command"`
+	Timeout  duration `json:"timeout"`
+	Interval duration `json:"interval"`
+}
+
+// loadScripts reads the list of scripts from the JSON file.
+func loadScripts(path string) ([]execScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var scripts []execScript
+	err = json.Unmarshal(data, &scripts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongExecConfig, err)
+	}
+
+	names := map[string]bool{}
+	for _, script := range scripts {
+		if len(script.Name) == 0 || len(script.Command) == 0 {
+			return nil, fmt.Errorf("%w: script must have a name and a command", ErrWrongExecConfig)
+		}
+		if names[script.Name] {
+			return nil, fmt.Errorf("%w: script %q is listed twice", ErrWrongExecConfig, script.Name)
+		}
+		names[script.Name] = true
+	}
+	return scripts, nil
+}
+
+// execCollector runs the script and reads metrics from its output. The
+// output is either a JSON array of metrics or lines "name type value", where
+// the value of a counter is the increment. Empty lines and lines starting
+// with # are skipped.
+type execCollector struct {
+	script execScript
+}
+
+func (c *execCollector) Name() string {
+	return withLabel(ExecCollector, c.script.Name)
+}
+
+func (c *execCollector) Interval() time.Duration {
+	return time.Duration(c.script.Interval)
+}
+
+func (c *execCollector) Collect(ctx context.Context) ([]Sample, error) {
+	timeout := time.Duration(c.script.Timeout)
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := run(ctx, c.script.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseOutput(output)
+}
+
+// run runs the command and returns its output. When ctx is done, the command
+// is killed along with processes it started, which could keep its output
+// open otherwise.
+func run(ctx context.Context, command []string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := startGroup(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killGroup(cmd)
+		<-done
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseOutput returns samples of the well-formed metrics of the output along
+// with the error about the first malformed one.
+func parseOutput(output []byte) ([]Sample, error) {
+	output = bytes.TrimSpace(output)
+	if bytes.HasPrefix(output, []byte("[")) {
+		return parseJSONOutput(output)
+	}
+
+	var res []Sample
+	var resErr error
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		sample, err := parseLine(text)
+		if err != nil {
+			if resErr == nil {
+				resErr = fmt.Errorf("%w: line %d: %q", ErrWrongOutput, line, text)
+			}
+			continue
+		}
+		res = append(res, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	return res, resErr
+}
+
+func parseLine(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return Sample{}, ErrWrongOutput
+	}
+
+	switch fields[1] {
+	case gauge:
+		value, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Sample{}, err
+		}
+		return Gauge(fields[0], value), nil
+	case counter:
+		delta, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Sample{}, err
+		}
+		return Counter(fields[0], delta), nil
+	default:
+		return Sample{}, ErrWrongOutput
+	}
+}
+
+func parseJSONOutput(output []byte) ([]Sample, error) {
+	var batch []metrics.Metric
+	err := json.Unmarshal(output, &batch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongOutput, err)
+	}
+
+	var res []Sample
+	var resErr error
+	for _, m := range batch {
+		switch {
+		case len(m.ID) > 0 && m.MType == gauge && m.Value != nil:
+			res = append(res, Gauge(m.ID, *m.Value))
+		case len(m.ID) > 0 && m.MType == counter && m.Delta != nil:
+			res = append(res, Counter(m.ID, *m.Delta))
+		default:
+			if resErr == nil {
+				resErr = fmt.Errorf("%w: metric %q of type %q", ErrWrongOutput, m.ID, m.MType)
+			}
+		}
+	}
+	return res, resErr
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/agent/config"
+)
+
+func Test_parseOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []Sample
+		wantErr bool
+	}{
+		{
+			name:   "lines",
+			output: "# queue stats\nQueueSize gauge 12.5\n\nQueueErrors counter 3\n",
+			want:   []Sample{Gauge("QueueSize", 12.5), Counter("QueueErrors", 3)},
+		},
+		{
+			name:    "wrong lines",
+			output:  "QueueSize gauge 12.5\nQueueSize gauge\nQueueErrors counter 1.5\nQueueErrors histogram 1\nQueueErrors counter 3\n",
+			want:    []Sample{Gauge("QueueSize", 12.5), Counter("QueueErrors", 3)},
+			wantErr: true,
+		},
+		{
+			name:   "json",
+			output: ` [{"id":"QueueSize","type":"gauge","value":12.5},{"id":"QueueErrors","type":"counter","delta":3}]`,
+			want:   []Sample{Gauge("QueueSize", 12.5), Counter("QueueErrors", 3)},
+		},
+		{
+			name:    "wrong json metric",
+			output:  `[{"id":"QueueSize","type":"gauge"},{"id":"QueueErrors","type":"counter","delta":3}]`,
+			want:    []Sample{Counter("QueueErrors", 3)},
+			wantErr: true,
+		},
+		{
+			name:    "broken json",
+			output:  `[{"id":`,
+			wantErr: true,
+		},
+		{
+			name:   "empty",
+			output: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := parseOutput([]byte(tt.output))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrWrongOutput)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+}
+
+func Test_execCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  execScript
+		want    []Sample
+		wantErr bool
+	}{
+		{
+			name:   "output",
+			script: execScript{Name: "echo", Command: []string{"sh", "-c", "echo 'QueueSize gauge 12.5'"}},
+			want:   []Sample{Gauge("QueueSize", 12.5)},
+		},
+		{
+			name:    "failed",
+			script:  execScript{Name: "fail", Command: []string{"sh", "-c", "echo 'QueueSize gauge 12.5'; echo oops >&2; exit 1"}},
+			wantErr: true,
+		},
+		{
+			name:    "timeout",
+			script:  execScript{Name: "sleep", Command: []string{"sleep", "10"}, Timeout: duration(50 * time.Millisecond)},
+			wantErr: true,
+		},
+		{
+			name:    "timeout of child process",
+			script:  execScript{Name: "child", Command: []string{"sh", "-c", "sleep 10; echo 'QueueSize gauge 12.5'"}, Timeout: duration(50 * time.Millisecond)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &execCollector{script: tt.script}
+			assert.Equal(t, "exec:"+tt.script.Name, c.Name())
+
+			start := time.Now()
+			samples, err := c.Collect(context.Background())
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			assert.Equal(t, tt.want, samples)
+			assert.Less(t, time.Since(start), 5*time.Second, "script must be killed on timeout")
+		})
+	}
+}
+
+func Test_execFactory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exec.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "queue", "command": ["queue-size"], "timeout": "5s", "interval": "1m"},
+		{"name": "jobs", "command": ["jobs", "--all"]}
+	]`), 0600))
+
+	collectors, err := New(config.Config{Collectors: ExecCollector, ExecConfig: path})
+	require.NoError(t, err)
+	require.Len(t, collectors, 2)
+	assert.Equal(t, "exec:queue", collectors[0].Name())
+	assert.Equal(t, time.Minute, collectors[0].(Scheduled).Interval())
+	assert.Equal(t, "exec:jobs", collectors[1].Name())
+	assert.Equal(t, time.Duration(0), collectors[1].(Scheduled).Interval())
+
+	_, err = New(config.Config{Collectors: ExecCollector})
+	assert.ErrorIs(t, err, ErrNoExecConfig)
+
+	for _, content := range []string{
+		`[{"name": "queue"}]`,
+		`[{"name": "queue", "command": ["a"]}, {"name": "queue", "command": ["b"]}]`,
+		`[{"name": "queue", "command": ["a"], "timeout": "soon"}]`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		_, err = New(config.Config{Collectors: ExecCollector, ExecConfig: path})
+		assert.Error(t, err, content)
+	}
+}
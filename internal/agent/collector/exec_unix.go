@@ -0,0 +1,20 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startGroup starts the command in its own process group, so processes the
+// command starts may be killed along with it.
+func startGroup(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd.Start()
+}
+
+// killGroup kills the process group of the command started by startGroup.
+func killGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,16 @@
+package collector
+
+import (
+	"os/exec"
+)
+
+// startGroup starts the command. Windows has no process groups to kill, so
+// only the command itself is killed on timeout.
+func startGroup(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// killGroup kills the command started by startGroup.
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,33 @@
+package collector
+
+// withLabel adds the label to the name of the metric, e.g. the mountpoint
+// or the device the metric is about: "DiskUsed:/var".
+func withLabel(name, label string) string {
+	return name + ":" + label
+}
+
+// counterDeltas turns cumulative counters of the system into increments
+// since the previous collect. The first value of the counter is the baseline,
+// so restarting the agent doesn't count the history twice. A value less
+// than the previous one means the counter was reset and is counted entirely.
+type counterDeltas struct {
+	prev map[string]uint64
+}
+
+func newCounterDeltas() *counterDeltas {
+	return &counterDeltas{prev: map[string]uint64{}}
+}
+
+func (d *counterDeltas) sample(name string, value uint64) Sample {
+	prev, ok := d.prev[name]
+	d.prev[name] = value
+
+	switch {
+	case !ok:
+		return Counter(name, 0)
+	case value < prev:
+		return Counter(name, int64(value))
+	default:
+		return Counter(name, int64(value-prev))
+	}
+}
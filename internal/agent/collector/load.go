@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// loadCollector reads 1, 5 and 15 minute load averages of the host.
+type loadCollector struct{}
+
+func (c *loadCollector) Name() string {
+	return LoadCollector
+}
+
+func (c *loadCollector) Collect(ctx context.Context) ([]Sample, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Sample{
+		Gauge("LoadAverage1", avg.Load1),
+		Gauge("LoadAverage5", avg.Load5),
+		Gauge("LoadAverage15", avg.Load15),
+	}, nil
+}
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrNoLogConfig    = errors.New("log config isn't set")
+	ErrWrongLogConfig = errors.New("wrong log config")
+	ErrWrongLogValue  = errors.New("wrong value in log line")
+)
+
+// logRule turns lines of the log matching the pattern into the metric. The
+// name and the value of the metric may refer to capture groups of the
+// pattern as $1 or ${name}. A counter is incremented by the value or by one
+// if there is no value, a gauge is set to the value.
+type logRule struct {
+	Pattern string `json:"pattern"`
+	Metric  string `json:"metric"`
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+// logFile is the log the log collector tails, as it's listed in the log
+// config file.
+type logFile struct {
+	Path  string    `json:"path"`
+	Rules []logRule `json:"rules"`
+}
+
+// loadLogFiles reads the list of logs and their rules from the JSON file.
+func loadLogFiles(path string) ([]logFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []logFile
+	err = json.Unmarshal(data, &files)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongLogConfig, err)
+	}
+
+	paths := map[string]bool{}
+	for i, file := range files {
+		if len(file.Path) == 0 || len(file.Rules) == 0 {
+			return nil, fmt.Errorf("%w: log must have a path and rules", ErrWrongLogConfig)
+		}
+		if paths[file.Path] {
+			return nil, fmt.Errorf("%w: log %q is listed twice", ErrWrongLogConfig, file.Path)
+		}
+		paths[file.Path] = true
+
+		for j, rule := range file.Rules {
+			if len(rule.Metric) == 0 {
+				return nil, fmt.Errorf("%w: log %q: rule must have a metric", ErrWrongLogConfig, file.Path)
+			}
+			if rule.Type != gauge && rule.Type != counter {
+				return nil, fmt.Errorf("%w: log %q: unknown type %q of %q", ErrWrongLogConfig, file.Path, rule.Type, rule.Metric)
+			}
+			if rule.Type == gauge && len(rule.Value) == 0 {
+				return nil, fmt.Errorf("%w: log %q: gauge %q must have a value", ErrWrongLogConfig, file.Path, rule.Metric)
+			}
+
+			files[i].Rules[j].re, err = regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: log %q: %v", ErrWrongLogConfig, file.Path, err)
+			}
+		}
+	}
+	return files, nil
+}
+
+// logCollector tails the log and reports metrics of lines written since the
+// previous collect. Lines written before the agent started are skipped. When
+// the log is rotated, the rest of the old file is read and the new file is
+// read from the beginning; when the log is truncated, it's read from the
+// beginning too.
+type logCollector struct {
+	log logFile
+
+	mu      sync.Mutex
+	started bool
+	file    *os.File
+	offset  int64
+	partial []byte
+}
+
+func (c *logCollector) Name() string {
+	return withLabel(LogCollector, c.log.Path)
+}
+
+func (c *logCollector) Collect(ctx context.Context) ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gauges := map[string]float64{}
+	counters := map[string]int64{}
+	var resErr error
+	err := c.tail(func(line string) {
+		err := c.match(line, gauges, counters)
+		if err != nil && resErr == nil {
+			resErr = err
+		}
+	})
+	if err != nil {
+		resErr = err
+	}
+
+	var names []string
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var res []Sample
+	for _, name := range names {
+		res = append(res, Gauge(name, gauges[name]))
+	}
+
+	names = names[:0]
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res = append(res, Counter(name, counters[name]))
+	}
+	return res, resErr
+}
+
+// match applies rules to the line: gauges keep the last value, counters
+// sum increments.
+func (c *logCollector) match(line string, gauges map[string]float64, counters map[string]int64) error {
+	var resErr error
+	for _, rule := range c.log.Rules {
+		submatches := rule.re.FindStringSubmatchIndex(line)
+		if submatches == nil {
+			continue
+		}
+		name := string(rule.re.ExpandString(nil, rule.Metric, line, submatches))
+		value := string(rule.re.ExpandString(nil, rule.Value, line, submatches))
+
+		var err error
+		switch {
+		case rule.Type == gauge:
+			var v float64
+			v, err = strconv.ParseFloat(value, 64)
+			if err == nil {
+				gauges[name] = v
+			}
+		case len(rule.Value) == 0:
+			counters[name]++
+		default:
+			var v int64
+			v, err = strconv.ParseInt(value, 10, 64)
+			if err == nil {
+				counters[name] += v
+			}
+		}
+		if err != nil && resErr == nil {
+			resErr = fmt.Errorf("%w: %q of %q", ErrWrongLogValue, value, rule.Metric)
+		}
+	}
+	return resErr
+}
+
+// tail passes lines written since the previous call to fn. The line which
+// isn't finished yet is kept until its end is written.
+func (c *logCollector) tail(fn func(line string)) error {
+	if c.file == nil {
+		// The log is read from the end only on start, a log appeared later
+		// is read entirely.
+		err := c.open(c.started)
+		c.started = true
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		err := c.readLines(fn)
+		if err != nil {
+			return err
+		}
+
+		current, err := c.file.Stat()
+		if err != nil {
+			return err
+		}
+		latest, err := os.Stat(c.log.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			// The log is rotated, but the new one isn't created yet.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !os.SameFile(current, latest):
+			// The old file won't be written anymore, so its last line is complete.
+			if len(c.partial) > 0 {
+				fn(string(c.partial))
+			}
+			c.file.Close()
+			c.file = nil
+			c.partial = nil
+			err = c.open(true)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		case latest.Size() < c.offset:
+			_, err = c.file.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			c.offset = 0
+			c.partial = nil
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *logCollector) open(fromStart bool) error {
+	file, err := os.Open(c.log.Path)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if !fromStart {
+		offset, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	c.file = file
+	c.offset = offset
+	return nil
+}
+
+func (c *logCollector) readLines(fn func(line string)) error {
+	reader := bufio.NewReader(c.file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		c.offset += int64(len(data))
+		c.partial = append(c.partial, data...)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line := c.partial[:len(c.partial)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		fn(string(line))
+		c.partial = c.partial[:0]
+	}
+}
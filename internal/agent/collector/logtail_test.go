@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/agent/config"
+)
+
+func appendFile(t *testing.T, path, content string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+}
+
+func newTestLogCollector(t *testing.T, logPath string) Collector {
+	configPath := filepath.Join(t.TempDir(), "log.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`[{
+		"path": "`+logPath+`",
+		"rules": [
+			{"pattern": "\" (5\\d\\d) ", "metric": "HTTPErrors:$1", "type": "counter"},
+			{"pattern": "bytes=(\\d+)", "metric": "HTTPBytes", "type": "counter", "value": "$1"},
+			{"pattern": "request_time=(?P<seconds>[0-9.]+)", "metric": "RequestTime", "type": "gauge", "value": "${seconds}"}
+		]
+	}]`), 0600))
+
+	collectors, err := New(config.Config{Collectors: LogCollector, LogConfig: configPath})
+	require.NoError(t, err)
+	require.Len(t, collectors, 1)
+	assert.Equal(t, "log:"+logPath, collectors[0].Name())
+	return collectors[0]
+}
+
+func Test_logCollector_Collect(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	appendFile(t, logPath, "\"GET /\" 500 bytes=10 request_time=0.1\n")
+	c := newTestLogCollector(t, logPath)
+
+	// Lines written before the start are skipped.
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	appendFile(t, logPath, "\"GET /\" 200 bytes=20 request_time=0.2\n\"GET /\" 502 bytes=5 request_time=0.5\n\"GET /\" 502 bytes=1")
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Gauge("RequestTime", 0.5),
+		Counter("HTTPBytes", 25),
+		Counter("HTTPErrors:502", 1),
+	}, samples)
+
+	// The unfinished line is read when it's finished.
+	appendFile(t, logPath, "5 request_time=0.3\n")
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Gauge("RequestTime", 0.3),
+		Counter("HTTPBytes", 15),
+		Counter("HTTPErrors:502", 1),
+	}, samples)
+
+	// The value which isn't a number is reported, other lines still count.
+	appendFile(t, logPath, "\"GET /\" 503 request_time=0.1.1\n")
+	samples, err = c.Collect(context.Background())
+	assert.ErrorIs(t, err, ErrWrongLogValue)
+	assert.Equal(t, []Sample{Counter("HTTPErrors:503", 1)}, samples)
+}
+
+func Test_logCollector_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	appendFile(t, logPath, "")
+	c := newTestLogCollector(t, logPath)
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// The rest of the rotated log is read along with the new log.
+	appendFile(t, logPath, "\"GET /\" 500 \n\"GET /\" 501 ")
+	require.NoError(t, os.Rename(logPath, logPath+".1"))
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{Counter("HTTPErrors:500", 1)}, samples)
+
+	appendFile(t, logPath+".1", "\n")
+	appendFile(t, logPath, "\"GET /\" 502 \n")
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Counter("HTTPErrors:501", 1),
+		Counter("HTTPErrors:502", 1),
+	}, samples)
+
+	// The truncated log is read from the beginning once it's shorter than
+	// it was read.
+	require.NoError(t, os.Truncate(logPath, 0))
+	appendFile(t, logPath, "\" 503 \n")
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{Counter("HTTPErrors:503", 1)}, samples)
+}
+
+func Test_logCollector_LogAppearsLater(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	c := newTestLogCollector(t, logPath)
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	appendFile(t, logPath, "\"GET /\" 500 \n")
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{Counter("HTTPErrors:500", 1)}, samples)
+}
+
+func Test_loadLogFiles(t *testing.T) {
+	_, err := New(config.Config{Collectors: LogCollector})
+	assert.ErrorIs(t, err, ErrNoLogConfig)
+
+	path := filepath.Join(t.TempDir(), "log.json")
+	for _, content := range []string{
+		`{`,
+		`[{"path": "a.log"}]`,
+		`[{"path": "a.log", "rules": [{"pattern": "x", "type": "counter"}]}]`,
+		`[{"path": "a.log", "rules": [{"pattern": "x", "metric": "X", "type": "histogram"}]}]`,
+		`[{"path": "a.log", "rules": [{"pattern": "x", "metric": "X", "type": "gauge"}]}]`,
+		`[{"path": "a.log", "rules": [{"pattern": "(", "metric": "X", "type": "counter"}]}]`,
+		`[{"path": "a.log", "rules": [{"pattern": "x", "metric": "X", "type": "counter"}]}, {"path": "a.log", "rules": [{"pattern": "y", "metric": "Y", "type": "counter"}]}]`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		_, err = loadLogFiles(path)
+		assert.ErrorIs(t, err, ErrWrongLogConfig, content)
+	}
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// tcpStates are states of TCP connections reported even if there are no
+// connections in them, so the gauges drop to zero instead of staying stale.
+// They are listed in order of their codes in /proc/net/tcp starting from 1.
+var tcpStates = []string{
+	"ESTABLISHED",
+	"SYN_SENT",
+	"SYN_RECV",
+	"FIN_WAIT1",
+	"FIN_WAIT2",
+	"TIME_WAIT",
+	"CLOSE",
+	"CLOSE_WAIT",
+	"LAST_ACK",
+	"LISTEN",
+	"CLOSING",
+}
+
+// netCollector reads bytes, packets, errors and drops sent and received by
+// every network interface as counters.
+type netCollector struct {
+	ioCounters func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+
+	mu     sync.Mutex
+	deltas *counterDeltas
+}
+
+func newNetCollector() *netCollector {
+	return &netCollector{
+		ioCounters: net.IOCountersWithContext,
+		deltas:     newCounterDeltas(),
+	}
+}
+
+func (c *netCollector) Name() string {
+	return NetCollector
+}
+
+func (c *netCollector) Collect(ctx context.Context) ([]Sample, error) {
+	counters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res []Sample
+	for _, stat := range counters {
+		res = append(res,
+			c.deltas.sample(withLabel("NetBytesSent", stat.Name), stat.BytesSent),
+			c.deltas.sample(withLabel("NetBytesRecv", stat.Name), stat.BytesRecv),
+			c.deltas.sample(withLabel("NetPacketsSent", stat.Name), stat.PacketsSent),
+			c.deltas.sample(withLabel("NetPacketsRecv", stat.Name), stat.PacketsRecv),
+			c.deltas.sample(withLabel("NetErrorsOut", stat.Name), stat.Errout),
+			c.deltas.sample(withLabel("NetErrorsIn", stat.Name), stat.Errin),
+			c.deltas.sample(withLabel("NetDropsOut", stat.Name), stat.Dropout),
+			c.deltas.sample(withLabel("NetDropsIn", stat.Name), stat.Dropin),
+		)
+	}
+	return res, nil
+}
+
+// tcpCollector counts TCP connections of the host by their state. The
+// states are read from the connection tables of the kernel, which is much
+// cheaper than finding the process of every connection.
+type tcpCollector struct {
+	procRoot string
+}
+
+func newTCPCollector() *tcpCollector {
+	return &tcpCollector{procRoot: "/proc"}
+}
+
+func (c *tcpCollector) Name() string {
+	return TCPCollector
+}
+
+func (c *tcpCollector) Collect(ctx context.Context) ([]Sample, error) {
+	counts := make([]int, len(tcpStates))
+	err := c.countStates(filepath.Join(c.procRoot, "net", "tcp"), counts)
+	if err != nil {
+		return nil, err
+	}
+	err = c.countStates(filepath.Join(c.procRoot, "net", "tcp6"), counts)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// There is no table of IPv6 connections if IPv6 is disabled.
+		return nil, err
+	}
+
+	var res []Sample
+	for i, state := range tcpStates {
+		res = append(res, Gauge(withLabel("TCPConnections", state), float64(counts[i])))
+	}
+	return res, nil
+}
+
+// countStates adds connections of the table to counts of their states. The
+// state is the fourth column of the table, written in hex.
+func (c *tcpCollector) countStates(path string, counts []int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// The first line is the header.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil || state < 1 || int(state) > len(counts) {
+			continue
+		}
+		counts[state-1]++
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_netCollector_Collect(t *testing.T) {
+	counters := []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 100, BytesRecv: 200, PacketsSent: 1, PacketsRecv: 2, Errout: 0, Errin: 1, Dropout: 0, Dropin: 3},
+	}
+	c := newNetCollector()
+	c.ioCounters = func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error) {
+		assert.True(t, pernic)
+		return counters, nil
+	}
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	for _, sample := range samples {
+		assert.Equal(t, int64(0), sample.Delta, sample.Name)
+	}
+
+	counters = []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 150, BytesRecv: 260, PacketsSent: 2, PacketsRecv: 4, Errout: 1, Errin: 1, Dropout: 0, Dropin: 5},
+	}
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Counter("NetBytesSent:eth0", 50),
+		Counter("NetBytesRecv:eth0", 60),
+		Counter("NetPacketsSent:eth0", 1),
+		Counter("NetPacketsRecv:eth0", 2),
+		Counter("NetErrorsOut:eth0", 1),
+		Counter("NetErrorsIn:eth0", 0),
+		Counter("NetDropsOut:eth0", 0),
+		Counter("NetDropsIn:eth0", 2),
+	}, samples)
+}
+
+func Test_tcpCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]float64
+	}{
+		{
+			name: "IPv4 and IPv6",
+			files: map[string]string{
+				"net/tcp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 20362 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:A2F4 0100007F:0CEA 01 00000000:00000000 00:00000000 00000000  1000        0 61263 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:A2F6 0100007F:0CEA 06 00000000:00000000 03:00000A2D 00000000     0        0 0 3 0000000000000000
+`,
+				"net/tcp6": `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23150 1 0000000000000000 100 0 0 10 0
+   1: 0000000000000000FFFF00000100007F:1F90 0000000000000000FFFF00000100007F:D5A8 01 00000000:00000000 00:00000000 00000000     0        0 71345 1 0000000000000000 20 4 28 10 -1
+`,
+			},
+			want: map[string]float64{"ESTABLISHED": 2, "LISTEN": 2, "TIME_WAIT": 1},
+		},
+		{
+			name: "IPv6 is disabled",
+			files: map[string]string{
+				"net/tcp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 20362 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:A2F4 0100007F:0CEA 08 00000000:00000000 00:00000000 00000000  1000        0 61263 1 0000000000000000 20 4 30 10 -1
+`,
+			},
+			want: map[string]float64{"LISTEN": 1, "CLOSE_WAIT": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			c := newTCPCollector()
+			c.procRoot = root
+
+			samples, err := c.Collect(context.Background())
+			require.NoError(t, err)
+
+			got := map[string]float64{}
+			for _, sample := range samples {
+				got[sample.Name] = sample.Value
+			}
+			assert.Len(t, got, len(tcpStates))
+			for _, state := range tcpStates {
+				assert.Equal(t, tt.want[state], got["TCPConnections:"+state], state)
+			}
+		})
+	}
+}
+
+func Test_tcpCollector_NoTable(t *testing.T) {
+	c := newTCPCollector()
+	c.procRoot = t.TempDir()
+	_, err := c.Collect(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,261 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var ErrNoProcesses = errors.New("neither process names nor pidfiles are set")
+
+// processStat is what the process collector reads about a single process.
+type processStat struct {
+	cpuTime    float64 // user and system CPU seconds
+	createTime time.Time
+	rss        uint64
+	fds        int32
+	threads    int32
+}
+
+// cpuReading is CPU seconds of the process at the moment of the collect.
+type cpuReading struct {
+	cpuTime float64
+	at      time.Time
+}
+
+// processCollector reads CPU, memory, file descriptors, threads and uptime
+// of processes selected by name patterns or pidfiles. Processes with the same
+// name are reported together: their values are summed, and the uptime is the
+// one of the oldest process.
+type processCollector struct {
+	patterns []string
+	pidfiles []string
+
+	pids func(ctx context.Context) ([]int32, error)
+	name func(ctx context.Context, pid int32) (string, error)
+	stat func(ctx context.Context, pid int32) (processStat, error)
+	now  func() time.Time
+
+	mu   sync.Mutex
+	prev map[int32]cpuReading
+}
+
+func newProcessCollector(names, pidfiles string) (*processCollector, error) {
+	c := &processCollector{
+		patterns: splitList(names),
+		pidfiles: splitList(pidfiles),
+		pids:     process.PidsWithContext,
+		name:     processName,
+		stat:     readProcessStat,
+		now:      time.Now,
+		prev:     map[int32]cpuReading{},
+	}
+	if len(c.patterns) == 0 && len(c.pidfiles) == 0 {
+		return nil, ErrNoProcesses
+	}
+
+	for _, pattern := range c.patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *processCollector) Name() string {
+	return ProcessCollector
+}
+
+func (c *processCollector) Collect(ctx context.Context) ([]Sample, error) {
+	selected, err := c.selectProcesses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type total struct {
+		count      int
+		cpu        float64
+		rss        uint64
+		fds        int64
+		threads    int64
+		createTime time.Time
+	}
+	totals := map[string]*total{}
+	prev := c.prev
+	c.prev = map[int32]cpuReading{}
+	for pid, name := range selected {
+		stat, err := c.stat(ctx, pid)
+		if err != nil {
+			// The process may have exited or be inaccessible, others still count.
+			continue
+		}
+
+		now := c.now()
+		c.prev[pid] = cpuReading{cpuTime: stat.cpuTime, at: now}
+
+		t, ok := totals[name]
+		if !ok {
+			t = &total{createTime: stat.createTime}
+			totals[name] = t
+		}
+		t.count++
+		t.cpu += cpuPercent(prev[pid], stat, now)
+		t.rss += stat.rss
+		t.fds += int64(stat.fds)
+		t.threads += int64(stat.threads)
+		if stat.createTime.Before(t.createTime) {
+			t.createTime = stat.createTime
+		}
+	}
+
+	var names []string
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var res []Sample
+	now := c.now()
+	for _, name := range names {
+		t := totals[name]
+		res = append(res,
+			Gauge(withLabel("ProcessCount", name), float64(t.count)),
+			Gauge(withLabel("ProcessCPU", name), t.cpu),
+			Gauge(withLabel("ProcessRSS", name), float64(t.rss)),
+			Gauge(withLabel("ProcessFDs", name), float64(t.fds)),
+			Gauge(withLabel("ProcessThreads", name), float64(t.threads)),
+			Gauge(withLabel("ProcessUptime", name), now.Sub(t.createTime).Seconds()),
+		)
+	}
+	return res, nil
+}
+
+// selectProcesses returns names of processes listed in pidfiles or matching
+// name patterns by their pids.
+func (c *processCollector) selectProcesses(ctx context.Context) (map[int32]string, error) {
+	res := map[int32]string{}
+	for _, pidfile := range c.pidfiles {
+		pid, err := readPidfile(pidfile)
+		if err != nil {
+			// The daemon isn't running, so there is nothing to report.
+			continue
+		}
+		name, err := c.name(ctx, pid)
+		if err != nil {
+			continue
+		}
+		res[pid] = name
+	}
+
+	if len(c.patterns) == 0 {
+		return res, nil
+	}
+
+	pids, err := c.pids(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range pids {
+		if _, ok := res[pid]; ok {
+			continue
+		}
+		name, err := c.name(ctx, pid)
+		if err != nil {
+			continue
+		}
+		if c.matches(name) {
+			res[pid] = name
+		}
+	}
+	return res, nil
+}
+
+func (c *processCollector) matches(name string) bool {
+	for _, pattern := range c.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cpuPercent returns CPU usage of the process since the previous collect, or
+// since the process started if it wasn't seen before.
+func cpuPercent(prev cpuReading, stat processStat, now time.Time) float64 {
+	if prev.at.IsZero() {
+		prev = cpuReading{at: stat.createTime}
+	}
+	elapsed := now.Sub(prev.at).Seconds()
+	if elapsed <= 0 || stat.cpuTime < prev.cpuTime {
+		return 0
+	}
+	return (stat.cpuTime - prev.cpuTime) / elapsed * 100
+}
+
+func readPidfile(pidfile string) (int32, error) {
+	data, err := os.ReadFile(pidfile)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(pid), nil
+}
+
+func processName(ctx context.Context, pid int32) (string, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return "", err
+	}
+	return p.NameWithContext(ctx)
+}
+
+func readProcessStat(ctx context.Context, pid int32) (processStat, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return processStat{}, err
+	}
+
+	times, err := p.TimesWithContext(ctx)
+	if err != nil {
+		return processStat{}, err
+	}
+	createTime, err := p.CreateTimeWithContext(ctx)
+	if err != nil {
+		return processStat{}, err
+	}
+	memory, err := p.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return processStat{}, err
+	}
+	fds, err := p.NumFDsWithContext(ctx)
+	if err != nil {
+		return processStat{}, err
+	}
+	threads, err := p.NumThreadsWithContext(ctx)
+	if err != nil {
+		return processStat{}, err
+	}
+
+	return processStat{
+		cpuTime:    times.User + times.System,
+		createTime: time.UnixMilli(createTime),
+		rss:        memory.RSS,
+		fds:        fds,
+		threads:    threads,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newProcessCollector(t *testing.T) {
+	_, err := newProcessCollector("", "")
+	assert.ErrorIs(t, err, ErrNoProcesses)
+
+	_, err = newProcessCollector("nginx[", "")
+	assert.Error(t, err)
+
+	_, err = newProcessCollector("nginx,postgres*", "")
+	assert.NoError(t, err)
+}
+
+func Test_processCollector_Collect(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "daemon.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte("30\n"), 0600))
+
+	start := time.Date(2022, 10, 19, 12, 0, 0, 0, time.UTC)
+	now := start.Add(100 * time.Second)
+	names := map[int32]string{10: "nginx", 11: "nginx", 20: "postgres", 30: "daemon", 40: "bash"}
+	stats := map[int32]processStat{
+		10: {cpuTime: 10, createTime: start, rss: 100, fds: 5, threads: 1},
+		11: {cpuTime: 20, createTime: start.Add(50 * time.Second), rss: 200, fds: 6, threads: 2},
+		30: {cpuTime: 50, createTime: start, rss: 300, fds: 7, threads: 3},
+	}
+
+	c, err := newProcessCollector("nginx,post*", filepath.Join(t.TempDir(), "missing.pid")+","+pidfile)
+	require.NoError(t, err)
+	c.pids = func(ctx context.Context) ([]int32, error) {
+		return []int32{10, 11, 20, 30, 40}, nil
+	}
+	c.name = func(ctx context.Context, pid int32) (string, error) {
+		return names[pid], nil
+	}
+	c.stat = func(ctx context.Context, pid int32) (processStat, error) {
+		stat, ok := stats[pid]
+		if !ok {
+			return processStat{}, errors.New("no such process")
+		}
+		return stat, nil
+	}
+	c.now = func() time.Time { return now }
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		Gauge("ProcessCount:daemon", 1),
+		Gauge("ProcessCPU:daemon", 50),
+		Gauge("ProcessRSS:daemon", 300),
+		Gauge("ProcessFDs:daemon", 7),
+		Gauge("ProcessThreads:daemon", 3),
+		Gauge("ProcessUptime:daemon", 100),
+		Gauge("ProcessCount:nginx", 2),
+		Gauge("ProcessCPU:nginx", 50),
+		Gauge("ProcessRSS:nginx", 300),
+		Gauge("ProcessFDs:nginx", 11),
+		Gauge("ProcessThreads:nginx", 3),
+		Gauge("ProcessUptime:nginx", 100),
+	}, samples)
+
+	// The second collect reports CPU usage since the first one.
+	now = now.Add(10 * time.Second)
+	stats[10] = processStat{cpuTime: 15, createTime: start, rss: 100, fds: 5, threads: 1}
+	delete(stats, 11)
+	samples, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, samples, Gauge("ProcessCount:nginx", 1))
+	assert.Contains(t, samples, Gauge("ProcessCPU:nginx", 50))
+	assert.Contains(t, samples, Gauge("ProcessCPU:daemon", 0))
+}
+
+func Test_processCollector_Self(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "self.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())), 0600))
+
+	c, err := newProcessCollector("", pidfile)
+	require.NoError(t, err)
+
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, samples, 6)
+	assert.Equal(t, float64(1), samples[0].Value)
+	for _, sample := range samples[2:5] {
+		assert.Greater(t, sample.Value, float64(0), sample.Name)
+	}
+}
@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nivanov045/metrics-monitor/internal/agent/config"
+)
+
+const (
+	RuntimeCollector = "runtime"
+	SystemCollector  = "system"
+	CPUCollector     = "cpu"
+	LoadCollector    = "load"
+	UptimeCollector  = "uptime"
+	DiskCollector    = "disk"
+	DiskIOCollector  = "diskio"
+	NetCollector     = "net"
+	TCPCollector     = "tcp"
+	ProcessCollector = "process"
+	CgroupCollector  = "cgroup"
+	ExecCollector    = "exec"
+	LogCollector     = "log"
+)
+
+var (
+	ErrUnknownCollector = errors.New("unknown collector")
+	ErrWrongInterval    = errors.New("wrong collector interval")
+)
+
+// Factory creates collectors from the agent config. One factory may create
+// several collectors, e.g. one per configured source.
+type Factory func(config config.Config) ([]Collector, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes the collector available by the name. It panics if the
+// collector with the same name is already registered.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("collector: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("collector: Register called twice for collector " + name)
+	}
+	factories[name] = factory
+}
+
+// Names returns sorted names of registered collectors.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	var res []string
+	for name := range factories {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// New creates collectors enabled by the config in the order they are listed.
+func New(config config.Config) ([]Collector, error) {
+	var res []Collector
+	for _, name := range splitList(config.Collectors) {
+		factoriesMu.RLock()
+		factory, ok := factories[name]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCollector, name)
+		}
+
+		collectors, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("collector %q: %w", name, err)
+		}
+		res = append(res, collectors...)
+	}
+	return res, nil
+}
+
+// Intervals parses poll intervals of collectors from the config, which are
+// listed as name=duration separated by commas, e.g. "runtime=2s,system=10s".
+func Intervals(config config.Config) (map[string]time.Duration, error) {
+	res := map[string]time.Duration{}
+	for _, item := range splitList(config.CollectorIntervals) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrWrongInterval, item)
+		}
+
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrWrongInterval, item)
+		}
+		res[strings.TrimSpace(name)] = interval
+	}
+	return res, nil
+}
+
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func init() {
+	Register(RuntimeCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{&runtimeCollector{}}, nil
+	})
+	Register(SystemCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{&systemCollector{}}, nil
+	})
+	Register(CPUCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newCPUCollector()}, nil
+	})
+	Register(LoadCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{&loadCollector{}}, nil
+	})
+	Register(UptimeCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{&uptimeCollector{}}, nil
+	})
+	Register(DiskCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newDiskCollector(config.DiskIncludeFSTypes, config.DiskExcludeFSTypes)}, nil
+	})
+	Register(DiskIOCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newDiskIOCollector()}, nil
+	})
+	Register(NetCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newNetCollector()}, nil
+	})
+	Register(TCPCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newTCPCollector()}, nil
+	})
+	Register(ProcessCollector, func(config config.Config) ([]Collector, error) {
+		c, err := newProcessCollector(config.ProcessNames, config.ProcessPidfiles)
+		if err != nil {
+			return nil, err
+		}
+		return []Collector{c}, nil
+	})
+	Register(CgroupCollector, func(config config.Config) ([]Collector, error) {
+		return []Collector{newCgroupCollector(config.CgroupRoot)}, nil
+	})
+	Register(ExecCollector, func(config config.Config) ([]Collector, error) {
+		if len(config.ExecConfig) == 0 {
+			return nil, ErrNoExecConfig
+		}
+
+		scripts, err := loadScripts(config.ExecConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		var res []Collector
+		for _, script := range scripts {
+			res = append(res, &execCollector{script: script})
+		}
+		return res, nil
+	})
+	Register(LogCollector, func(config config.Config) ([]Collector, error) {
+		if len(config.LogConfig) == 0 {
+			return nil, ErrNoLogConfig
+		}
+
+		files, err := loadLogFiles(config.LogConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		var res []Collector
+		for _, file := range files {
+			res = append(res, &logCollector{log: file})
+		}
+		return res, nil
+	})
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/agent/config"
+)
+
+type fakeCollector struct {
+	name string
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Collect(ctx context.Context) ([]Sample, error) {
+	return []Sample{Gauge(c.name, 1)}, nil
+}
+
+func TestNew(t *testing.T) {
+	Register("test-pair", func(config config.Config) ([]Collector, error) {
+		return []Collector{&fakeCollector{name: "first"}, &fakeCollector{name: "second"}}, nil
+	})
+	Register("test-broken", func(config config.Config) ([]Collector, error) {
+		return nil, errors.New("broken")
+	})
+
+	assert.Contains(t, Names(), RuntimeCollector)
+	assert.Contains(t, Names(), SystemCollector)
+
+	collectors, err := New(config.Config{Collectors: " runtime, test-pair ,"})
+	require.NoError(t, err)
+	var names []string
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{RuntimeCollector, "first", "second"}, names)
+
+	collectors, err = New(config.Config{})
+	assert.NoError(t, err)
+	assert.Empty(t, collectors)
+
+	_, err = New(config.Config{Collectors: "runtime,unknown"})
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+
+	_, err = New(config.Config{Collectors: "test-broken"})
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		Register(RuntimeCollector, func(config config.Config) ([]Collector, error) { return nil, nil })
+	})
+}
+
+func TestIntervals(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  map[string]time.Duration{},
+		},
+		{
+			name:  "several",
+			value: "runtime=1s, system = 10s",
+			want:  map[string]time.Duration{RuntimeCollector: time.Second, SystemCollector: 10 * time.Second},
+		},
+		{
+			name:    "no duration",
+			value:   "runtime",
+			wantErr: true,
+		},
+		{
+			name:    "wrong duration",
+			value:   "runtime=often",
+			wantErr: true,
+		},
+		{
+			name:    "zero duration",
+			value:   "runtime=0s",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Intervals(config.Config{CollectorIntervals: tt.value})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrWrongInterval)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
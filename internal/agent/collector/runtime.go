@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+)
+
+// runtimeGauges are memory statistics of the Go runtime reported as gauges.
+var runtimeGauges = []struct {
+	name  string
+	value func(*runtime.MemStats) float64
+}{
+	{"Alloc", func(m *runtime.MemStats) float64 { return float64(m.Alloc) }},
+	{"BuckHashSys", func(m *runtime.MemStats) float64 { return float64(m.BuckHashSys) }},
+	{"Frees", func(m *runtime.MemStats) float64 { return float64(m.Frees) }},
+	{"GCCPUFraction", func(m *runtime.MemStats) float64 { return m.GCCPUFraction }},
+	{"GCSys", func(m *runtime.MemStats) float64 { return float64(m.GCSys) }},
+	{"HeapAlloc", func(m *runtime.MemStats) float64 { return float64(m.HeapAlloc) }},
+	{"HeapIdle", func(m *runtime.MemStats) float64 { return float64(m.HeapIdle) }},
+	{"HeapInuse", func(m *runtime.MemStats) float64 { return float64(m.HeapInuse) }},
+	{"HeapObjects", func(m *runtime.MemStats) float64 { return float64(m.HeapObjects) }},
+	{"HeapReleased", func(m *runtime.MemStats) float64 { return float64(m.HeapReleased) }},
+	{"HeapSys", func(m *runtime.MemStats) float64 { return float64(m.HeapSys) }},
+	{"LastGC", func(m *runtime.MemStats) float64 { return float64(m.LastGC) }},
+	{"Lookups", func(m *runtime.MemStats) float64 { return float64(m.Lookups) }},
+	{"MCacheInuse", func(m *runtime.MemStats) float64 { return float64(m.MCacheInuse) }},
+	{"MCacheSys", func(m *runtime.MemStats) float64 { return float64(m.MCacheSys) }},
+	{"MSpanInuse", func(m *runtime.MemStats) float64 { return float64(m.MSpanInuse) }},
+	{"MSpanSys", func(m *runtime.MemStats) float64 { return float64(m.MSpanSys) }},
+	{"Mallocs", func(m *runtime.MemStats) float64 { return float64(m.Mallocs) }},
+	{"NextGC", func(m *runtime.MemStats) float64 { return float64(m.NextGC) }},
+	{"NumForcedGC", func(m *runtime.MemStats) float64 { return float64(m.NumForcedGC) }},
+	{"NumGC", func(m *runtime.MemStats) float64 { return float64(m.NumGC) }},
+	{"OtherSys", func(m *runtime.MemStats) float64 { return float64(m.OtherSys) }},
+	{"PauseTotalNs", func(m *runtime.MemStats) float64 { return float64(m.PauseTotalNs) }},
+	{"StackInuse", func(m *runtime.MemStats) float64 { return float64(m.StackInuse) }},
+	{"StackSys", func(m *runtime.MemStats) float64 { return float64(m.StackSys) }},
+	{"Sys", func(m *runtime.MemStats) float64 { return float64(m.Sys) }},
+	{"TotalAlloc", func(m *runtime.MemStats) float64 { return float64(m.TotalAlloc) }},
+}
+
+// runtimeCollector reads memory statistics of the agent itself, a random
+// value and counts polls.
+type runtimeCollector struct{}
+
+func (c *runtimeCollector) Name() string {
+	return RuntimeCollector
+}
+
+func (c *runtimeCollector) Collect(ctx context.Context) ([]Sample, error) {
+	var memStat runtime.MemStats
+	runtime.ReadMemStats(&memStat)
+
+	res := make([]Sample, 0, len(runtimeGauges)+2)
+	for _, g := range runtimeGauges {
+		res = append(res, Gauge(g.name, g.value(&memStat)))
+	}
+	res = append(res, Gauge("RandomValue", rand.Float64()))
+	res = append(res, Counter("PollCount", 1))
+	return res, nil
+}
@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_runtimeCollector_Collect(t *testing.T) {
+	c := &runtimeCollector{}
+	samples, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	var gauges, counters int
+	for _, sample := range samples {
+		if sample.IsCounter() {
+			counters++
+			assert.Equal(t, Counter("PollCount", 1), sample)
+		} else {
+			gauges++
+		}
+	}
+	assert.Equal(t, 28, gauges)
+	assert.Equal(t, 1, counters)
+}
@@ -0,0 +1,25 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// systemCollector reads memory of the host.
+type systemCollector struct{}
+
+func (c *systemCollector) Name() string {
+	return SystemCollector
+}
+
+func (c *systemCollector) Collect(ctx context.Context) ([]Sample, error) {
+	var res []Sample
+
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return res, err
+	}
+	res = append(res, Gauge("TotalMemory", float64(v.Total)), Gauge("FreeMemory", float64(v.Free)))
+	return res, nil
+}
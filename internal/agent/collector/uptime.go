@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// uptimeCollector reads seconds since the host booted.
+type uptimeCollector struct{}
+
+func (c *uptimeCollector) Name() string {
+	return UptimeCollector
+}
+
+func (c *uptimeCollector) Collect(ctx context.Context) ([]Sample, error) {
+	uptime, err := host.UptimeWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Sample{Gauge("Uptime", float64(uptime))}, nil
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"flag"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/caarlos0/env/v6"
@@ -9,10 +11,28 @@ import (
 )
 
 type Config struct {
-	Address        string        `env:"ADDRESS"`
-	ReportInterval time.Duration `env:"REPORT_INTERVAL"`
-	PollInterval   time.Duration `env:"POLL_INTERVAL"`
-	Key            string        `env:"KEY"`
+	Address            string        `env:"ADDRESS"`
+	ReportInterval     time.Duration `env:"REPORT_INTERVAL"`
+	PollInterval       time.Duration `env:"POLL_INTERVAL"`
+	Key                string        `env:"KEY"`
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	SpoolDir           string        `env:"SPOOL_DIR"`
+	SpoolMaxBatches    int           `env:"SPOOL_MAX_BATCHES"`
+	RequestTimeout     time.Duration `env:"REQUEST_TIMEOUT"`
+	Retries            int           `env:"RETRIES"`
+	RetryBackoff       time.Duration `env:"RETRY_BACKOFF"`
+	MaxRetryBackoff    time.Duration `env:"RETRY_MAX_BACKOFF"`
+	RateLimit          int           `env:"RATE_LIMIT"`
+	Compress           bool          `env:"COMPRESS"`
+	Collectors         string        `env:"COLLECTORS"`
+	CollectorIntervals string        `env:"COLLECTOR_INTERVALS"`
+	DiskIncludeFSTypes string        `env:"DISK_INCLUDE_FSTYPES"`
+	DiskExcludeFSTypes string        `env:"DISK_EXCLUDE_FSTYPES"`
+	ProcessNames       string        `env:"PROCESS_NAMES"`
+	ProcessPidfiles    string        `env:"PROCESS_PIDFILES"`
+	CgroupRoot         string        `env:"CGROUP_ROOT"`
+	ExecConfig         string        `env:"EXEC_CONFIG"`
+	LogConfig          string        `env:"LOG_CONFIG"`
 }
 
 func BuildConfig() (Config, error) {
@@ -27,9 +47,42 @@ func (cfg *Config) buildFromFlags() {
 	flag.DurationVar(&cfg.PollInterval, "p", 2*time.Second, "poll interval")
 	flag.DurationVar(&cfg.ReportInterval, "r", 5*time.Second, "report interval")
 	flag.StringVar(&cfg.Key, "k", "", "key")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 5*time.Second, "timeout of sending the final report on shutdown")
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", defaultSpoolDir(), "directory to keep unsent metrics in; empty to disable")
+	flag.IntVar(&cfg.SpoolMaxBatches, "spool-max-batches", 100, "max number of unsent batches kept in the spool")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", 5*time.Second, "timeout of a single request to the server")
+	flag.IntVar(&cfg.Retries, "retries", 3, "number of retries of the failed request")
+	flag.DurationVar(&cfg.RetryBackoff, "retry-backoff", 100*time.Millisecond, "delay before the first retry, doubled for every next one")
+	flag.DurationVar(&cfg.MaxRetryBackoff, "retry-max-backoff", 5*time.Second, "max delay between retries")
+	flag.IntVar(&cfg.RateLimit, "l", 1, "max number of concurrent requests to the server")
+	flag.BoolVar(&cfg.Compress, "compress", true, "compress request bodies with gzip")
+	flag.StringVar(&cfg.Collectors, "collectors", "runtime,system,cpu,load,uptime,disk,diskio,net", "enabled collectors separated by commas")
+	flag.StringVar(&cfg.CollectorIntervals, "collector-intervals", "", "poll intervals of collectors as name=duration separated by commas")
+	flag.StringVar(&cfg.DiskIncludeFSTypes, "disk-include-fstypes", "", "filesystem types the disk collector reads, separated by commas")
+	flag.StringVar(&cfg.DiskExcludeFSTypes, "disk-exclude-fstypes", "tmpfs,devtmpfs,overlay,squashfs", "filesystem types the disk collector skips, separated by commas")
+	flag.StringVar(&cfg.ProcessNames, "process-names", "", "name patterns of processes the process collector reads, separated by commas")
+	flag.StringVar(&cfg.ProcessPidfiles, "process-pidfiles", "", "pidfiles of processes the process collector reads, separated by commas")
+	flag.StringVar(&cfg.CgroupRoot, "cgroup-root", "/sys/fs/cgroup", "directory the cgroup collector reads cgroup files from")
+	flag.StringVar(&cfg.ExecConfig, "exec-config", "", "JSON file with scripts the exec collector runs")
+	flag.StringVar(&cfg.LogConfig, "log-config", "", "JSON file with logs the log collector tails and their rules")
 	flag.Parse()
 }
 
+// defaultSpoolDir returns the spool directory in the state directory of the
+// user, $XDG_STATE_HOME or ~/.local/state, or an empty value to disable the
+// spool if there is no home directory.
+func defaultSpoolDir() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if len(stateDir) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "metrics-agent", "spool")
+}
+
 func (cfg *Config) buildFromEnv() error {
 	err := env.Parse(cfg)
 	if err != nil {
@@ -7,13 +7,16 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/nivanov045/metrics-monitor/internal/agent/collector"
 	"github.com/nivanov045/metrics-monitor/internal/agent/config"
-	"github.com/nivanov045/metrics-monitor/internal/agent/metricsperformer"
 	"github.com/nivanov045/metrics-monitor/internal/agent/requester"
+	"github.com/nivanov045/metrics-monitor/internal/agent/spool"
 	"github.com/nivanov045/metrics-monitor/internal/metrics"
 )
 
@@ -21,63 +24,107 @@ type metricsagent struct {
 	metricsChannel chan metrics.Metrics
 	config         config.Config
 	requester      requester.Requester
+	spool          *spool.Spool
+	collectors     []collector.Collector
+	intervals      map[string]time.Duration
+
+	selfMu      sync.Mutex
+	selfMetrics map[string]metrics.Counter
+
+	// reported keeps values of counters already sent as deltas.
+	reportedMu sync.Mutex
+	reported   map[string]metrics.Counter
 }
 
-func New(c config.Config) *metricsagent {
-	return &metricsagent{
+// Names of counters the agent reports about itself.
+const (
+	sentMetrics     = "SentMetrics"
+	failedMetrics   = "FailedMetrics"
+	rejectedMetrics = "RejectedMetrics"
+)
+
+func New(c config.Config) (*metricsagent, error) {
+	collectors, err := collector.New(c)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals, err := collector.Intervals(c)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &metricsagent{
 		metricsChannel: make(chan metrics.Metrics, 1),
 		config:         c,
-		requester:      *requester.New(c.Address),
+		requester: *requester.New(c.Address, requester.Options{
+			Timeout:         c.RequestTimeout,
+			Retries:         c.Retries,
+			RetryBackoff:    c.RetryBackoff,
+			MaxRetryBackoff: c.MaxRetryBackoff,
+			Compress:        c.Compress,
+		}),
+		selfMetrics: map[string]metrics.Counter{
+			sentMetrics:     0,
+			failedMetrics:   0,
+			rejectedMetrics: 0,
+		},
+		reported:   map[string]metrics.Counter{},
+		collectors: collectors,
+		intervals:  intervals,
 	}
-}
 
-func (a *metricsagent) updateRuntimeMetrics() {
-	ticker := time.NewTicker(a.config.PollInterval)
-	ctx := context.Background()
-	for {
-		select {
-		case <-ctx.Done():
-			log.Debug().Msg("end select for update")
-			return
-		case <-ticker.C:
-			log.Debug().Msg("start update")
-
-			mOriginal := <-a.metricsChannel
-			mCopy := mOriginal.Clone()
-			a.metricsChannel <- mOriginal
+	if len(c.SpoolDir) > 0 {
+		res.spool, err = spool.New(c.SpoolDir, c.SpoolMaxBatches)
+		if err != nil {
+			log.Error().Err(err).Stack().Msg("can't create spool; unsent gauges will be dropped")
+		}
+	}
 
-			metricsperformer.UpdateRuntimeMetrics(mCopy)
-			<-a.metricsChannel
-			a.metricsChannel <- mCopy
+	return res, nil
+}
 
-			log.Debug().Msg("finish update")
+// runCollector collects metrics on start and then every interval of
+// the collector until ctx is done.
+func (a *metricsagent) runCollector(ctx context.Context, c collector.Collector) {
+	interval, ok := a.intervals[c.Name()]
+	if !ok {
+		interval = a.config.PollInterval
+		if s, ok := c.(collector.Scheduled); ok && s.Interval() > 0 {
+			interval = s.Interval()
 		}
 	}
-}
 
-func (a *metricsagent) updateAdditionalMetrics() {
-	ticker := time.NewTicker(a.config.PollInterval)
-	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
+		log.Debug().Str("collector", c.Name()).Msg("start collect")
+		samples, err := c.Collect(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("collector", c.Name()).Msg("can't collect metrics")
+		}
+		a.apply(samples)
+		log.Debug().Str("collector", c.Name()).Int("samples", len(samples)).Msg("finish collect")
+
 		select {
 		case <-ctx.Done():
-			log.Debug().Msg("end select for update addititonal metrics")
+			log.Debug().Str("collector", c.Name()).Msg("end select for collect")
 			return
 		case <-ticker.C:
-			log.Debug().Msg("start update of additional metrics")
-
-			mOriginal := <-a.metricsChannel
-			mCopy := mOriginal.Clone()
-			a.metricsChannel <- mOriginal
+		}
+	}
+}
 
-			err := metricsperformer.UpdateAdditionalMetrics(mCopy)
-			if err != nil {
-				log.Error().Err(err).Stack()
-			}
-			<-a.metricsChannel
-			a.metricsChannel <- mCopy
+// apply saves gauges and adds increments of counters to current metrics.
+func (a *metricsagent) apply(samples []collector.Sample) {
+	m := <-a.metricsChannel
+	defer func() { a.metricsChannel <- m }()
 
-			log.Debug().Msg("finish update of additional metrics")
+	for _, sample := range samples {
+		if sample.IsCounter() {
+			m.CounterMetrics[sample.Name] += metrics.Counter(sample.Delta)
+		} else {
+			m.GaugeMetrics[sample.Name] = metrics.Gauge(sample.Value)
 		}
 	}
 }
@@ -92,7 +139,11 @@ func createHash(key []byte, m metrics.Metric) []byte {
 	return h.Sum(nil)
 }
 
-func (a *metricsagent) Start() {
+// Run collects and sends metrics until ctx is done. Then it waits for
+// collecting to stop, sends queued batches and collected metrics for the
+// last time, waiting for the server no longer than the shutdown timeout
+// altogether. Metrics which weren't sent by then are spooled.
+func (a *metricsagent) Run(ctx context.Context) {
 	log.Debug().Msg("metricsagent started")
 
 	a.metricsChannel <- metrics.Metrics{
@@ -100,71 +151,265 @@ func (a *metricsagent) Start() {
 		CounterMetrics: map[string]metrics.Counter{},
 	}
 
-	go a.updateRuntimeMetrics()
-	go a.updateAdditionalMetrics()
-	go a.sendSeveralMetrics()
+	rateLimit := a.config.RateLimit
+	if rateLimit < 1 {
+		rateLimit = 1
+	}
+	batches := make(chan []metrics.Metric, rateLimit)
+
+	// Workers aren't interrupted until the shutdown timeout expires.
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+	defer cancelDrain()
+
+	var workers sync.WaitGroup
+	for i := 0; i < rateLimit; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.sendWorker(drainCtx, batches)
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range a.collectors {
+		wg.Add(1)
+		go func(c collector.Collector) {
+			defer wg.Done()
+			a.runCollector(ctx, c)
+		}(c)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.sendSeveralMetrics(ctx, batches)
+	}()
+	wg.Wait()
+
+	deadline := time.Now().Add(a.config.ShutdownTimeout)
+	drainTimer := time.AfterFunc(a.config.ShutdownTimeout, cancelDrain)
+	defer drainTimer.Stop()
+
+	close(batches)
+	workers.Wait()
+
+	log.Info().Msg("sending final report")
+	finalCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	err := a.report(finalCtx)
+	if err != nil {
+		log.Error().Err(err).Stack().Msg("final report wasn't sent")
+		return
+	}
+
+	log.Info().Msg("final report was sent")
 }
 
-func (a *metricsagent) sendSeveralMetrics() {
+// sendSeveralMetrics queues the batch of current metrics for workers every
+// report interval. If all workers are busy and the queue is full, the batch
+// is skipped: its counters are sent with the next batch.
+func (a *metricsagent) sendSeveralMetrics(ctx context.Context, batches chan<- []metrics.Metric) {
 	ticker := time.NewTicker(a.config.ReportInterval)
-	ctx := context.Background()
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			log.Debug().Msg("end select for sending metrics")
 			return
 		case <-ticker.C:
-			mOriginal := <-a.metricsChannel
-			m := mOriginal.Clone()
-			a.metricsChannel <- mOriginal
-
-			var toSend []metrics.Metric
-			for key, val := range m.GaugeMetrics {
-				asFloat := float64(val)
-				metricForSend := metrics.Metric{
-					ID:    key,
-					MType: "gauge",
-					Delta: nil,
-					Value: &asFloat,
-				}
-
-				if len(a.config.Key) > 0 {
-					hash := createHash([]byte(a.config.Key), metricForSend)
-					metricForSend.Hash = hex.EncodeToString(hash)
-				}
-
-				toSend = append(toSend, metricForSend)
+			batch := a.collect()
+			select {
+			case batches <- batch:
+			default:
+				log.Warn().Msg("send queue is full; metrics are skipped")
+				a.rollback(batch)
 			}
+		}
+	}
+}
 
-			pc := m.CounterMetrics["PollCount"]
-			asInt := int64(pc)
-			metricForSend := metrics.Metric{
-				ID:    "PollCount",
-				MType: "counter",
-				Delta: &asInt,
-				Value: nil,
-			}
+// sendWorker sends queued batches until the queue is closed. Sending isn't
+// interrupted by the shutdown itself: the server may have already saved
+// metrics, so sending them again would count counters twice. Attempts are
+// limited by the request timeout, and once ctx is done after the shutdown
+// timeout, batches left in the queue are spooled.
+func (a *metricsagent) sendWorker(ctx context.Context, batches <-chan []metrics.Metric) {
+	for batch := range batches {
+		err := a.deliver(ctx, batch)
+		if err != nil {
+			log.Error().Err(err).Stack().Msg("metrics weren't sent")
+			continue
+		}
 
-			if len(a.config.Key) > 0 {
-				hash := createHash([]byte(a.config.Key), metricForSend)
-				metricForSend.Hash = hex.EncodeToString(hash)
-			}
+		log.Debug().Msg("metrics were sent")
+	}
+}
 
-			toSend = append(toSend, metricForSend)
+// report sends current metrics.
+func (a *metricsagent) report(ctx context.Context) error {
+	return a.deliver(ctx, a.collect())
+}
 
-			marshalled, err := json.Marshal(toSend)
-			if err != nil {
-				log.Error().Err(err).Stack()
-				return
-			}
+// deliver sends spooled metrics and then the batch to the server. If the
+// server is unreachable, the batch is spooled to be sent later, or its
+// counters are sent with the next batch if there is no spool. The same
+// happens to metrics the server failed to save. Metrics rejected by the
+// server for other reasons are dropped.
+func (a *metricsagent) deliver(ctx context.Context, batch []metrics.Metric) error {
+	if a.spool == nil {
+		retry, err := a.send(ctx, batch)
+		if err != nil && !requester.IsPermanent(err) {
+			retry = batch
+		}
+		a.rollback(retry)
+		return err
+	}
+
+	var retry []metrics.Metric
+	err := a.spool.Drain(func(spooled []metrics.Metric) error {
+		failed, err := a.send(ctx, spooled)
+		if requester.IsPermanent(err) {
+			return nil
+		}
+		retry = append(retry, failed...)
+		return err
+	})
+	// Spooled metrics the server failed to save are sent with the batch.
+	batch = spool.Merge(retry, batch)
+	if err == nil {
+		retry, err = a.send(ctx, batch)
+	}
+	if err != nil && !requester.IsPermanent(err) {
+		retry = batch
+	}
+	if len(retry) > 0 {
+		spoolErr := a.spool.Push(retry)
+		if spoolErr != nil {
+			log.Error().Err(spoolErr).Stack().Msg("can't spool metrics")
+			a.rollback(retry)
+			return err
+		}
+		log.Warn().Int("batches", a.spool.Len()).Msg("metrics were spooled")
+	}
+	return err
+}
+
+// collect makes the batch of current metrics. Counters are sent as deltas
+// since the last report, which are considered reported right away; rollback
+// returns them if the batch isn't handed off. The batch isn't signed, it's
+// signed when sent.
+func (a *metricsagent) collect() []metrics.Metric {
+	mOriginal := <-a.metricsChannel
+	m := mOriginal.Clone()
+	a.metricsChannel <- mOriginal
+
+	var res []metrics.Metric
+	for key, val := range m.GaugeMetrics {
+		asFloat := float64(val)
+		res = append(res, metrics.Metric{
+			ID:    key,
+			MType: "gauge",
+			Delta: nil,
+			Value: &asFloat,
+		})
+	}
+
+	var names, collected []string
+	totals := map[string]metrics.Counter{}
+	a.selfMu.Lock()
+	for name, val := range a.selfMetrics {
+		names = append(names, name)
+		totals[name] = val
+	}
+	a.selfMu.Unlock()
+	for name, val := range m.CounterMetrics {
+		if _, ok := totals[name]; ok {
+			continue
+		}
+		collected = append(collected, name)
+		totals[name] = val
+	}
+	sort.Strings(names)
+	sort.Strings(collected)
+	names = append(names, collected...)
+
+	a.reportedMu.Lock()
+	defer a.reportedMu.Unlock()
+	for _, name := range names {
+		asInt := int64(totals[name] - a.reported[name])
+		a.reported[name] = totals[name]
+		res = append(res, metrics.Metric{
+			ID:    name,
+			MType: "counter",
+			Delta: &asInt,
+			Value: nil,
+		})
+	}
+
+	return res
+}
+
+// rollback makes counter deltas of the batch unreported, so they are sent
+// with the next batch.
+func (a *metricsagent) rollback(batch []metrics.Metric) {
+	a.reportedMu.Lock()
+	defer a.reportedMu.Unlock()
+	for _, m := range batch {
+		if m.MType == "counter" && m.Delta != nil {
+			a.reported[m.ID] -= metrics.Counter(*m.Delta)
+		}
+	}
+}
+
+// send signs and sends the batch. If the server saved the batch, send
+// returns metrics it failed to save and which may be sent again.
+func (a *metricsagent) send(ctx context.Context, batch []metrics.Metric) ([]metrics.Metric, error) {
+	toSend := make([]metrics.Metric, len(batch))
+	for i, metricForSend := range batch {
+		if len(a.config.Key) > 0 {
+			hash := createHash([]byte(a.config.Key), metricForSend)
+			metricForSend.Hash = hex.EncodeToString(hash)
+		}
+		toSend[i] = metricForSend
+	}
+
+	marshalled, err := json.Marshal(toSend)
+	if err != nil {
+		return nil, err
+	}
 
-			err = a.requester.SendSeveral(marshalled)
-			if err != nil {
-				log.Error().Err(err).Stack()
-				return
+	rejections, err := a.requester.SendSeveral(ctx, marshalled)
+	switch {
+	case err == nil:
+		retryable := map[string]bool{}
+		for _, rejection := range rejections {
+			log.Warn().Str("id", rejection.ID).Str("type", rejection.MType).Str("reason", rejection.Reason).Bool("retryable", rejection.Retryable).Msg("metric was rejected by the server")
+			if rejection.Retryable {
+				retryable[rejection.MType+":"+rejection.ID] = true
 			}
+		}
 
-			log.Debug().Msg("metrics were sent")
+		var retry []metrics.Metric
+		for _, m := range batch {
+			if retryable[m.MType+":"+m.ID] {
+				retry = append(retry, m)
+			}
 		}
+		a.countSelf(sentMetrics, len(batch)-len(rejections))
+		a.countSelf(rejectedMetrics, len(rejections)-len(retry))
+		a.countSelf(failedMetrics, len(retry))
+		return retry, nil
+	case requester.IsPermanent(err):
+		log.Error().Err(err).Msg("metrics were rejected by the server")
+		a.countSelf(rejectedMetrics, len(batch))
+	default:
+		a.countSelf(failedMetrics, len(batch))
 	}
+	return nil, err
+}
+
+func (a *metricsagent) countSelf(name string, n int) {
+	a.selfMu.Lock()
+	defer a.selfMu.Unlock()
+	a.selfMetrics[name] += metrics.Counter(n)
 }
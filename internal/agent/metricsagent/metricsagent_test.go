@@ -0,0 +1,456 @@
+package metricsagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/agent/collector"
+	"github.com/nivanov045/metrics-monitor/internal/agent/config"
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+	"github.com/nivanov045/metrics-monitor/internal/server/api"
+	serverconfig "github.com/nivanov045/metrics-monitor/internal/server/config"
+	"github.com/nivanov045/metrics-monitor/internal/server/service"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage"
+)
+
+func Test_metricsagent_FinalReport(t *testing.T) {
+	var mu sync.Mutex
+	var received [][]metrics.Metric
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		var batch []metrics.Metric
+		assert.NoError(t, json.Unmarshal(body, &batch))
+
+		mu.Lock()
+		received = append(received, batch)
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	agent, err := New(config.Config{
+		Address:         strings.TrimPrefix(server.URL, "http://"),
+		PollInterval:    time.Hour,
+		ReportInterval:  time.Hour,
+		ShutdownTimeout: time.Second,
+		Collectors:      "runtime",
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	agent.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "PollCount", received[0][len(received[0])-1].ID)
+}
+
+func Test_metricsagent_SpoolWhileServerIsDown(t *testing.T) {
+	var mu sync.Mutex
+	down := true
+	var received []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			panic(http.ErrAbortHandler)
+		}
+
+		var batch []metrics.Metric
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		for _, m := range batch {
+			if m.ID == "PollCount" {
+				received = append(received, *m.Delta)
+			}
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	agent, err := New(config.Config{
+		Address:         strings.TrimPrefix(server.URL, "http://"),
+		SpoolDir:        t.TempDir(),
+		SpoolMaxBatches: 2,
+	})
+	require.NoError(t, err)
+	agent.metricsChannel <- metrics.Metrics{
+		GaugeMetrics:   map[string]metrics.Gauge{},
+		CounterMetrics: map[string]metrics.Counter{},
+	}
+
+	setPollCount := func(val metrics.Counter) {
+		m := <-agent.metricsChannel
+		m.CounterMetrics["PollCount"] = val
+		agent.metricsChannel <- m
+	}
+
+	for i := 1; i <= 3; i++ {
+		setPollCount(metrics.Counter(i))
+		assert.Error(t, agent.report(context.Background()))
+	}
+	assert.Equal(t, 2, agent.spool.Len())
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	setPollCount(4)
+	require.NoError(t, agent.report(context.Background()))
+	assert.Equal(t, 0, agent.spool.Len())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{2, 1, 1}, received)
+}
+
+func Test_metricsagent_SelfMetrics(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"rejected":[{"id":"Alloc","type":"gauge","reason":"wrong hash"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	agent, err := New(config.Config{
+		Address:  strings.TrimPrefix(server.URL, "http://"),
+		SpoolDir: t.TempDir(),
+	})
+	require.NoError(t, err)
+	agent.metricsChannel <- metrics.Metrics{
+		GaugeMetrics:   map[string]metrics.Gauge{"Alloc": 1},
+		CounterMetrics: map[string]metrics.Counter{"PollCount": 1},
+	}
+
+	// The batch is Alloc, three self counters and PollCount.
+	require.NoError(t, agent.report(context.Background()))
+	assert.Equal(t, metrics.Counter(4), agent.selfMetrics[sentMetrics])
+	assert.Equal(t, metrics.Counter(1), agent.selfMetrics[rejectedMetrics])
+
+	mu.Lock()
+	status = http.StatusBadRequest
+	mu.Unlock()
+	assert.Error(t, agent.report(context.Background()))
+	assert.Equal(t, metrics.Counter(6), agent.selfMetrics[rejectedMetrics])
+	assert.Equal(t, 0, agent.spool.Len())
+
+	mu.Lock()
+	status = http.StatusServiceUnavailable
+	mu.Unlock()
+	assert.Error(t, agent.report(context.Background()))
+	assert.Equal(t, metrics.Counter(5), agent.selfMetrics[failedMetrics])
+	assert.Equal(t, 1, agent.spool.Len())
+}
+
+func Test_metricsagent_ServerTotalsEqualPollCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		spoolDir string
+	}{
+		{name: "without spool", spoolDir: ""},
+		{name: "with spool", spoolDir: t.TempDir()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			myStorage, err := storage.New(serverconfig.Config{StoreFile: filepath.Join(t.TempDir(), "metrics.json")})
+			require.NoError(t, err)
+			handler := api.New(service.New("", myStorage), time.Second).Handler()
+
+			// Every third request fails while the server is flaky.
+			var mu sync.Mutex
+			flaky := true
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				fail := flaky && requests%3 == 0
+				mu.Unlock()
+				if fail {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+
+			agent, err := New(config.Config{
+				Address:         strings.TrimPrefix(server.URL, "http://"),
+				Collectors:      "runtime,system",
+				PollInterval:    5 * time.Millisecond,
+				ReportInterval:  15 * time.Millisecond,
+				ShutdownTimeout: time.Second,
+				SpoolDir:        tt.spoolDir,
+				SpoolMaxBatches: 2,
+				RateLimit:       3,
+				Compress:        true,
+			})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				agent.Run(ctx)
+				close(done)
+			}()
+
+			time.Sleep(300 * time.Millisecond)
+			mu.Lock()
+			flaky = false
+			mu.Unlock()
+			cancel()
+			<-done
+
+			m := <-agent.metricsChannel
+			require.Greater(t, m.CounterMetrics["PollCount"], metrics.Counter(0))
+			total, ok := myStorage.GetCounterMetrics(context.Background(), "PollCount")
+			assert.True(t, ok)
+			assert.Equal(t, m.CounterMetrics["PollCount"], total)
+
+			sent, ok := myStorage.GetCounterMetrics(context.Background(), sentMetrics)
+			assert.True(t, ok)
+			assert.Greater(t, sent, metrics.Counter(0))
+		})
+	}
+}
+
+// flakyStorage fails to save the first counters.
+type flakyStorage struct {
+	service.Storage
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakyStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	s.mu.Lock()
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if fail {
+		return errors.New("connection refused")
+	}
+	return s.Storage.AddCounterMetrics(ctx, name, delta)
+}
+
+func Test_metricsagent_StorageFailureDoesNotLoseCounters(t *testing.T) {
+	tests := []struct {
+		name     string
+		spoolDir string
+	}{
+		{name: "without spool", spoolDir: ""},
+		{name: "with spool", spoolDir: t.TempDir()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			myStorage, err := storage.New(serverconfig.Config{StoreFile: filepath.Join(t.TempDir(), "metrics.json")})
+			require.NoError(t, err)
+			flaky := &flakyStorage{Storage: myStorage, failures: 10}
+			server := httptest.NewServer(api.New(service.New("", flaky), time.Second).Handler())
+			defer server.Close()
+
+			agent, err := New(config.Config{
+				Address:         strings.TrimPrefix(server.URL, "http://"),
+				Collectors:      "runtime",
+				PollInterval:    5 * time.Millisecond,
+				ReportInterval:  15 * time.Millisecond,
+				ShutdownTimeout: time.Second,
+				SpoolDir:        tt.spoolDir,
+				SpoolMaxBatches: 100,
+			})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			agent.Run(ctx)
+
+			flaky.mu.Lock()
+			assert.Equal(t, 0, flaky.failures)
+			flaky.mu.Unlock()
+
+			m := <-agent.metricsChannel
+			require.Greater(t, m.CounterMetrics["PollCount"], metrics.Counter(0))
+			total, ok := myStorage.GetCounterMetrics(context.Background(), "PollCount")
+			assert.True(t, ok)
+			assert.Equal(t, m.CounterMetrics["PollCount"], total)
+
+			failed, ok := myStorage.GetCounterMetrics(context.Background(), failedMetrics)
+			assert.True(t, ok)
+			assert.Greater(t, failed, metrics.Counter(0))
+		})
+	}
+}
+
+func Test_metricsagent_RateLimit(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive, requests := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		requests++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	agent, err := New(config.Config{
+		Address:         strings.TrimPrefix(server.URL, "http://"),
+		PollInterval:    time.Hour,
+		ReportInterval:  5 * time.Millisecond,
+		ShutdownTimeout: time.Second,
+		RateLimit:       2,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	agent.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, maxActive)
+	assert.Greater(t, requests, 4)
+}
+
+func Test_metricsagent_ShutdownTimeoutBoundsQueuedBatches(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	agent, err := New(config.Config{
+		Address:         strings.TrimPrefix(server.URL, "http://"),
+		PollInterval:    time.Hour,
+		ReportInterval:  5 * time.Millisecond,
+		ShutdownTimeout: 200 * time.Millisecond,
+		RequestTimeout:  5 * time.Second,
+		Retries:         3,
+		RateLimit:       1,
+		Collectors:      "runtime",
+		SpoolDir:        filepath.Join(t.TempDir(), "spool"),
+		SpoolMaxBatches: 100,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	agent.Run(ctx)
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Greater(t, agent.spool.Len(), 0)
+}
+
+func Test_metricsagent_CollectorInterval(t *testing.T) {
+	agent, err := New(config.Config{
+		PollInterval:       time.Hour,
+		ReportInterval:     time.Hour,
+		Collectors:         "runtime",
+		CollectorIntervals: "runtime=5ms",
+	})
+	require.NoError(t, err)
+	agent.metricsChannel <- metrics.Metrics{
+		GaugeMetrics:   map[string]metrics.Gauge{},
+		CounterMetrics: map[string]metrics.Counter{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	agent.runCollector(ctx, agent.collectors[0])
+
+	m := <-agent.metricsChannel
+	assert.Greater(t, m.CounterMetrics["PollCount"], metrics.Counter(5))
+	assert.Contains(t, m.GaugeMetrics, "Alloc")
+}
+
+type scheduledCollector struct {
+	interval time.Duration
+}
+
+func (c *scheduledCollector) Name() string {
+	return "scheduled"
+}
+
+func (c *scheduledCollector) Interval() time.Duration {
+	return c.interval
+}
+
+func (c *scheduledCollector) Collect(ctx context.Context) ([]collector.Sample, error) {
+	return []collector.Sample{collector.Counter("Collects", 1)}, nil
+}
+
+func Test_metricsagent_ScheduledCollector(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals string
+		wantMore  bool
+	}{
+		{
+			name:     "own interval",
+			wantMore: true,
+		},
+		{
+			name:      "agent config takes precedence",
+			intervals: "scheduled=1h",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := New(config.Config{
+				PollInterval:       time.Hour,
+				ReportInterval:     time.Hour,
+				CollectorIntervals: tt.intervals,
+			})
+			require.NoError(t, err)
+			agent.metricsChannel <- metrics.Metrics{
+				GaugeMetrics:   map[string]metrics.Gauge{},
+				CounterMetrics: map[string]metrics.Counter{},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			agent.runCollector(ctx, &scheduledCollector{interval: 5 * time.Millisecond})
+
+			m := <-agent.metricsChannel
+			if tt.wantMore {
+				assert.Greater(t, m.CounterMetrics["Collects"], metrics.Counter(5))
+			} else {
+				assert.Equal(t, metrics.Counter(1), m.CounterMetrics["Collects"])
+			}
+		})
+	}
+}
@@ -2,57 +2,151 @@ package requester
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
 )
 
+// Options tune timeouts and retries of requests.
+type Options struct {
+	// Timeout limits a single attempt of the request.
+	Timeout time.Duration
+	// Retries is a number of additional attempts of the request failed
+	// with a network error or a 5xx response.
+	Retries         int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// Compress enables gzip compression of request bodies.
+	Compress bool
+}
+
 type Requester struct {
 	address string
+	client  *http.Client
+	options Options
 }
 
-func New(address string) *Requester {
-	return &Requester{address: address}
+func New(address string, options Options) *Requester {
+	return &Requester{
+		address: address,
+		client:  &http.Client{Timeout: options.Timeout},
+		options: options,
+	}
 }
 
-func (r *Requester) Send(a []byte) error {
+func (r *Requester) Send(ctx context.Context, a []byte) error {
 	log.Debug().Interface("string", string(a)).Msg("started send of ")
-	client := &http.Client{}
-	request, err := http.NewRequest(http.MethodPost, "http://"+r.address+"/update/", bytes.NewBuffer(a))
-	request.Close = true
+	_, err := r.post(ctx, "/update/", a)
+	return err
+}
+
+// SendSeveral sends the batch of metrics and returns metrics of the batch
+// the server refused to save.
+func (r *Requester) SendSeveral(ctx context.Context, a []byte) ([]metrics.Rejection, error) {
+	log.Debug().Interface("string", string(a)).Msg("started send of several")
+	respBody, err := r.post(ctx, "/updates/", a)
 	if err != nil {
-		log.Error().Err(err).Stack()
-		return err
+		return nil, err
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	response, err := client.Do(request)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		return err
+	var result metrics.UpdatesResult
+	if len(bytes.TrimSpace(respBody)) > 0 {
+		err = json.Unmarshal(respBody, &result)
+		if err != nil {
+			log.Error().Err(err).Stack().Msg("can't parse response of the server")
+		}
 	}
+	return result.Rejected, nil
+}
 
-	defer response.Body.Close()
-	return nil
+// StatusError is returned when the server responds with the status
+// other than 2xx.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
 }
 
-func (r *Requester) SendSeveral(a []byte) error {
-	log.Debug().Interface("string", string(a)).Msg("started send of several")
-	client := &http.Client{}
-	request, err := http.NewRequest(http.MethodPost, "http://"+r.address+"/updates/", bytes.NewBuffer(a))
-	request.Close = true
-	if err != nil {
-		log.Error().Err(err).Stack()
-		return err
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Retryable reports whether the request may succeed if repeated.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsPermanent reports whether the server rejected the request, so it
+// won't succeed if repeated. Other errors are network errors or failures
+// of the server.
+func IsPermanent(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && !statusErr.Retryable()
+}
+
+func (r *Requester) post(ctx context.Context, path string, body []byte) ([]byte, error) {
+	if r.options.Compress {
+		var err error
+		body, err = compress(body)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return nil, err
+		}
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	response, err := client.Do(request)
-	if err != nil {
-		log.Error().Err(err).Stack()
+	var respBody []byte
+	err := r.withRetry(ctx, func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+r.address+path, bytes.NewReader(body))
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return err
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+		if r.options.Compress {
+			request.Header.Set("Content-Encoding", "gzip")
+		}
+		response, err := r.client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		respBody, err = io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+			return &StatusError{
+				StatusCode: response.StatusCode,
+				RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+			}
+		}
 		return nil
+	})
+	return respBody, err
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, err
 	}
 
-	defer response.Body.Close()
-	return nil
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,186 @@
+package requester
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+func TestRequester_SendSeveral(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		options      Options
+		wantErr      bool
+		wantAttempts int32
+		wantMinDelay time.Duration
+		wantMaxDelay time.Duration
+	}{
+		{
+			name:         "success",
+			statuses:     []int{http.StatusOK},
+			options:      Options{Retries: 3, RetryBackoff: time.Millisecond},
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry on 5xx",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			options:      Options{Retries: 3, RetryBackoff: time.Millisecond},
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries are exhausted",
+			statuses:     []int{http.StatusInternalServerError},
+			options:      Options{Retries: 2, RetryBackoff: time.Millisecond},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "no retry on 4xx",
+			statuses:     []int{http.StatusBadRequest},
+			options:      Options{Retries: 3, RetryBackoff: time.Millisecond},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry after",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "1",
+			options:      Options{Retries: 1, RetryBackoff: time.Millisecond},
+			wantAttempts: 2,
+			wantMinDelay: time.Second,
+		},
+		{
+			name:         "retry after is limited by max backoff",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			retryAfter:   "3600",
+			options:      Options{Retries: 1, RetryBackoff: time.Millisecond, MaxRetryBackoff: 50 * time.Millisecond},
+			wantAttempts: 2,
+			wantMinDelay: 50 * time.Millisecond,
+			wantMaxDelay: 5 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				status := tt.statuses[len(tt.statuses)-1]
+				if int(attempt) <= len(tt.statuses) {
+					status = tt.statuses[attempt-1]
+				}
+				if len(tt.retryAfter) > 0 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			r := New(strings.TrimPrefix(server.URL, "http://"), tt.options)
+			start := time.Now()
+			_, err := r.SendSeveral(context.Background(), []byte("[]"))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAttempts, atomic.LoadInt32(&attempts))
+			assert.GreaterOrEqual(t, time.Since(start), tt.wantMinDelay)
+			if tt.wantMaxDelay > 0 {
+				assert.Less(t, time.Since(start), tt.wantMaxDelay)
+			}
+		})
+	}
+}
+
+func TestRequester_Timeout(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	r := New(strings.TrimPrefix(server.URL, "http://"), Options{
+		Timeout:      50 * time.Millisecond,
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	})
+	_, err := r.SendSeveral(context.Background(), []byte("[]"))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestRequester_ContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	r := New(strings.TrimPrefix(server.URL, "http://"), Options{Retries: 100, RetryBackoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := r.SendSeveral(ctx, []byte("[]"))
+	assert.Error(t, err)
+}
+
+func TestRequester_Rejections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"rejected":[{"id":"Alloc","type":"gauge","reason":"wrong hash"}]}`))
+	}))
+	defer server.Close()
+
+	r := New(strings.TrimPrefix(server.URL, "http://"), Options{})
+	rejections, err := r.SendSeveral(context.Background(), []byte("[]"))
+	assert.NoError(t, err)
+	assert.Equal(t, []metrics.Rejection{{ID: "Alloc", MType: "gauge", Reason: "wrong hash"}}, rejections)
+}
+
+func TestRequester_Compress(t *testing.T) {
+	var encoding, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		reader, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	r := New(strings.TrimPrefix(server.URL, "http://"), Options{Compress: true})
+	_, err := r.SendSeveral(context.Background(), []byte(`[{"id":"Alloc","type":"gauge","value":1}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, `[{"id":"Alloc","type":"gauge","value":1}]`, body)
+}
+
+func TestIsPermanent(t *testing.T) {
+	assert.True(t, IsPermanent(&StatusError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, IsPermanent(&StatusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.False(t, IsPermanent(&StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsPermanent(errors.New("connection refused")))
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, parseRetryAfter("2"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	assert.InDelta(t, float64(time.Hour), float64(parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))), float64(2*time.Second))
+}
@@ -0,0 +1,82 @@
+package requester
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// withRetry runs op and repeats it with exponential backoff and jitter while
+// it fails with a network error or a retryable status, retries are left and
+// ctx isn't done. The delay isn't shorter than the one the server asked for
+// with Retry-After, but isn't longer than the max backoff either.
+func (r *Requester) withRetry(ctx context.Context, op func() error) error {
+	backoff := r.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.options.Retries || ctx.Err() != nil || IsPermanent(err) {
+			return err
+		}
+
+		delay := jitter(backoff)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+			if r.options.MaxRetryBackoff > 0 && delay > r.options.MaxRetryBackoff {
+				delay = r.options.MaxRetryBackoff
+			}
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt+1).Dur("backoff", delay).Msg("request failed; retrying")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		backoff *= 2
+		if r.options.MaxRetryBackoff > 0 && backoff > r.options.MaxRetryBackoff {
+			backoff = r.options.MaxRetryBackoff
+		}
+	}
+}
+
+// jitter returns a random duration between the half of backoff and backoff,
+// so agents don't retry all at once after the server restart.
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 1 {
+		return backoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)))
+}
+
+// parseRetryAfter parses the Retry-After header which is either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	if delay := time.Until(date); delay > 0 {
+		return delay
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package spool
+
+import (
+	"os"
+	"syscall"
+)
+
+// isPrivate reports whether the directory is owned by the current user and
+// isn't writable by others.
+func isPrivate(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() {
+		return false
+	}
+	return info.Mode().Perm()&0022 == 0
+}
@@ -0,0 +1,277 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+const batchExt = ".json"
+
+// ErrUnsafeDir is returned for the spool directory other users may write
+// batches to: the agent would sign and send them as its own.
+var ErrUnsafeDir = errors.New("spool directory is owned by another user or writable by others")
+
+// Spool keeps batches of metrics which weren't sent in the directory, one file
+// per batch, and gives them back in the order they were pushed. The number of
+// batches is bounded: when it's exceeded, the two oldest batches are merged.
+type Spool struct {
+	dir        string
+	maxBatches int
+	mu         sync.Mutex
+	// claimed are batches being sent or sent but failed to be removed,
+	// they are neither given back again nor merged.
+	claimed map[string]bool
+	remove  func(name string) error
+}
+
+func New(dir string, maxBatches int) (*Spool, error) {
+	if maxBatches < 1 {
+		maxBatches = 1
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !isPrivate(info) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeDir, dir)
+	}
+
+	return &Spool{dir: dir, maxBatches: maxBatches, claimed: map[string]bool{}, remove: os.Remove}, nil
+}
+
+// Len returns the number of spooled batches.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.list()
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return 0
+	}
+	return len(files)
+}
+
+// Push saves the batch after all spooled ones.
+func (s *Spool) Push(batch []metrics.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	var seq uint64 = 1
+	if len(files) > 0 {
+		seq = sequence(files[len(files)-1]) + 1
+	}
+
+	err = s.write(s.path(seq), batch)
+	if err != nil {
+		return err
+	}
+	files = s.unclaimed(append(files, s.path(seq)))
+
+	for len(files) > s.maxBatches {
+		log.Warn().Int("batches", len(files)).Msg("spool is full; merging oldest batches")
+		err = s.mergeOldest(files[0], files[1])
+		if err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+// Drain passes spooled batches to send from the oldest one and removes
+// them. It stops at the first batch send failed with and returns the error.
+// The spool isn't locked while the batch is sent, so other batches may be
+// pushed and drained meanwhile.
+func (s *Spool) Drain(send func([]metrics.Metric) error) error {
+	for {
+		path, err := s.claim()
+		if err != nil || len(path) == 0 {
+			return err
+		}
+
+		batch, err := s.read(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("dropping broken spooled batch")
+			s.release(path, true)
+			continue
+		}
+
+		err = send(batch)
+		if err != nil {
+			s.release(path, false)
+			return err
+		}
+		s.release(path, true)
+	}
+}
+
+// claim returns the oldest batch which isn't claimed yet and claims it, or
+// an empty path if there is no such batch.
+func (s *Spool) claim() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.list()
+	if err != nil {
+		return "", err
+	}
+
+	files = s.unclaimed(files)
+	if len(files) == 0 {
+		return "", nil
+	}
+	s.claimed[files[0]] = true
+	return files[0], nil
+}
+
+// release gives the claimed batch back to the spool or removes it if it's
+// delivered. The delivered batch which failed to be removed stays claimed,
+// so it isn't sent twice.
+func (s *Spool) release(path string, delivered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivered {
+		err := s.remove(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("can't remove delivered batch")
+			return
+		}
+	}
+	delete(s.claimed, path)
+}
+
+func (s *Spool) unclaimed(files []string) []string {
+	var res []string
+	for _, path := range files {
+		if !s.claimed[path] {
+			res = append(res, path)
+		}
+	}
+	return res
+}
+
+// mergeOldest replaces the newer batch with the merge of both and removes
+// the older one.
+func (s *Spool) mergeOldest(olderPath, newerPath string) error {
+	older, err := s.read(olderPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", olderPath).Msg("dropping broken spooled batch")
+		return os.Remove(olderPath)
+	}
+
+	newer, err := s.read(newerPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", newerPath).Msg("dropping broken spooled batch")
+		return os.Rename(olderPath, newerPath)
+	}
+
+	err = s.write(newerPath, Merge(older, newer))
+	if err != nil {
+		return err
+	}
+	return os.Remove(olderPath)
+}
+
+// Merge combines two batches so that sending the result has the same effect
+// as sending both of them: counter deltas are summed, gauges take newer values.
+func Merge(older, newer []metrics.Metric) []metrics.Metric {
+	var res []metrics.Metric
+	index := map[string]int{}
+	for _, batch := range [][]metrics.Metric{older, newer} {
+		for _, m := range batch {
+			key := m.MType + ":" + m.ID
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(res)
+				res = append(res, m)
+				continue
+			}
+
+			if m.MType == "counter" && m.Delta != nil && res[i].Delta != nil {
+				sum := *res[i].Delta + *m.Delta
+				res[i].Delta = &sum
+				continue
+			}
+			res[i] = m
+		}
+	}
+	return res
+}
+
+func (s *Spool) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), batchExt) {
+			continue
+		}
+		res = append(res, filepath.Join(s.dir, entry.Name()))
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, batchExt))
+}
+
+func sequence(path string) uint64 {
+	seq, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), batchExt), 10, 64)
+	return seq
+}
+
+func (s *Spool) read(path string) ([]metrics.Metric, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []metrics.Metric
+	err = json.Unmarshal(data, &batch)
+	return batch, err
+}
+
+// write saves the batch to the temporary file first, so the batch is never
+// seen partially written.
+func (s *Spool) write(path string, batch []metrics.Metric) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,127 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+func gauge(id string, val float64) metrics.Metric {
+	return metrics.Metric{ID: id, MType: "gauge", Value: &val}
+}
+
+func counter(id string, delta int64) metrics.Metric {
+	return metrics.Metric{ID: id, MType: "counter", Delta: &delta}
+}
+
+func TestSpool_DrainInOrder(t *testing.T) {
+	s, err := New(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, s.Push([]metrics.Metric{counter("PollCount", int64(i))}))
+	}
+	assert.Equal(t, 3, s.Len())
+
+	var sent []int64
+	err = s.Drain(func(batch []metrics.Metric) error {
+		if len(sent) == 2 {
+			return errors.New("server is down")
+		}
+		sent = append(sent, *batch[0].Delta)
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []int64{1, 2}, sent)
+	assert.Equal(t, 1, s.Len())
+
+	require.NoError(t, s.Push([]metrics.Metric{counter("PollCount", 4)}))
+	err = s.Drain(func(batch []metrics.Metric) error {
+		sent = append(sent, *batch[0].Delta)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4}, sent)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSpool_MergeOnOverflow(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]metrics.Metric{gauge("Alloc", 1), counter("PollCount", 1)}))
+	require.NoError(t, s.Push([]metrics.Metric{gauge("Alloc", 2), counter("PollCount", 2)}))
+	require.NoError(t, s.Push([]metrics.Metric{gauge("Alloc", 3), gauge("Frees", 5), counter("PollCount", 3)}))
+	assert.Equal(t, 2, s.Len())
+
+	reopened, err := New(dir, 2)
+	require.NoError(t, err)
+
+	var sent [][]metrics.Metric
+	require.NoError(t, reopened.Drain(func(batch []metrics.Metric) error {
+		sent = append(sent, batch)
+		return nil
+	}))
+	require.Len(t, sent, 2)
+	assert.Equal(t, []metrics.Metric{gauge("Alloc", 2), counter("PollCount", 3)}, sent[0])
+	assert.Equal(t, []metrics.Metric{gauge("Alloc", 3), gauge("Frees", 5), counter("PollCount", 3)}, sent[1])
+}
+
+func TestSpool_PushWhileDraining(t *testing.T) {
+	s, err := New(t.TempDir(), 10)
+	require.NoError(t, err)
+	require.NoError(t, s.Push([]metrics.Metric{counter("PollCount", 1)}))
+
+	var sent []int64
+	err = s.Drain(func(batch []metrics.Metric) error {
+		if len(sent) == 0 {
+			// The spool isn't locked while the batch is sent.
+			require.NoError(t, s.Push([]metrics.Metric{counter("PollCount", 2)}))
+		}
+		sent = append(sent, *batch[0].Delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, sent)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSpool_DeliveredBatchIsntResent(t *testing.T) {
+	s, err := New(t.TempDir(), 10)
+	require.NoError(t, err)
+	s.remove = func(string) error {
+		return errors.New("permission denied")
+	}
+	require.NoError(t, s.Push([]metrics.Metric{counter("PollCount", 1)}))
+
+	var sent int
+	send := func(batch []metrics.Metric) error {
+		sent++
+		return nil
+	}
+	require.NoError(t, s.Drain(send))
+	require.NoError(t, s.Drain(send))
+	assert.Equal(t, 1, sent)
+}
+
+func TestNew_UnsafeDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0777))
+
+	_, err := New(dir, 10)
+	assert.ErrorIs(t, err, ErrUnsafeDir)
+}
+
+func TestMerge(t *testing.T) {
+	older := []metrics.Metric{gauge("Alloc", 1), counter("PollCount", 2), counter("Old", 1)}
+	newer := []metrics.Metric{counter("PollCount", 3), gauge("Alloc", 4), gauge("New", 5)}
+
+	assert.Equal(t, []metrics.Metric{gauge("Alloc", 4), counter("PollCount", 5), counter("Old", 1), gauge("New", 5)},
+		Merge(older, newer))
+}
@@ -16,37 +16,17 @@ type Metric struct {
 	Hash  string   `json:"hash,omitempty"`  // value of hash
 }
 
-var KnownMetrics = [...]string{
-	"Alloc",
-	"BuckHashSys",
-	"Frees",
-	"GCCPUFraction",
-	"GCSys",
-	"HeapAlloc",
-	"HeapIdle",
-	"HeapInuse",
-	"HeapObjects",
-	"HeapReleased",
-	"HeapSys",
-	"LastGC",
-	"Lookups",
-	"MCacheInuse",
-	"MCacheSys",
-	"MSpanInuse",
-	"MSpanSys",
-	"Mallocs",
-	"NextGC",
-	"NumForcedGC",
-	"NumGC",
-	"OtherSys",
-	"PauseTotalNs",
-	"StackInuse",
-	"StackSys",
-	"Sys",
-	"TotalAlloc",
-	"RandomValue",
-	"PollCount",
-	"TotalMemory",
-	"FreeMemory",
-	"CPUutilization1",
+// Rejection describes the metric of the batch the server refused to save.
+// Retryable rejections are caused by the server failures, so the metric may
+// be saved if it's sent again.
+type Rejection struct {
+	ID        string `json:"id"`
+	MType     string `json:"type"`
+	Reason    string `json:"reason"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+// UpdatesResult is the response of the server to the batch of metrics.
+type UpdatesResult struct {
+	Rejected []Rejection `json:"rejected,omitempty"`
 }
@@ -1,33 +1,89 @@
 package api
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
 )
 
 type api struct {
-	service Service
+	service         Service
+	shutdownTimeout time.Duration
 }
 
-func New(service Service) *api {
-	return &api{service: service}
+func New(service Service, shutdownTimeout time.Duration) *api {
+	return &api{service: service, shutdownTimeout: shutdownTimeout}
 }
 
 var _ API = &api{}
 
-func (a *api) Run(address string) error {
+// Run serves requests until ctx is done, then stops accepting new connections
+// and waits for active requests for the shutdown timeout. Requests which are
+// still active after the timeout have their contexts cancelled.
+func (a *api) Run(ctx context.Context, address string) error {
 	log.Info().Interface("address", address).Msg("server started")
 
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	server := &http.Server{
+		Addr:        address,
+		Handler:     a.router(),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("server is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		cancelBase()
+		server.Close()
+		return err
+	}
+
+	log.Info().Msg("server stopped")
+	return nil
+}
+
+// Handler returns the handler serving the API without running the server.
+func (a *api) Handler() http.Handler {
+	return a.router()
+}
+
+func (a *api) router() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
+	r.Use(requestLogger)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(decompressRequest)
 	r.Use(middleware.Compress(5, "application/json", "text/html"))
 
 	r.Post("/update/", a.updateMetricsHandler)
@@ -36,27 +92,83 @@ func (a *api) Run(address string) error {
 
 	r.Get("/", a.rootHandler)
 	r.Get("/ping", a.pingDBHandler)
+	r.Get("/debug/db", a.dbStatsHandler)
 
-	return http.ListenAndServe(address, r)
+	return r
+}
+
+// requestLogger attaches the logger with the request ID to the request context,
+// so everything logged while handling the request can be correlated.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("request_id", middleware.GetReqID(r.Context())).Logger()
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context())))
+	})
+}
+
+// maxDecompressedBodySize limits the size of the decompressed request body,
+// so a small compressed body can't exhaust the memory of the server.
+const maxDecompressedBodySize = 10 << 20
+
+// decompressRequest transparently decompresses gzip request bodies, so
+// handlers read plain JSON. Requests with other encodings are refused.
+func decompressRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+		case "", "identity":
+		case "gzip":
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				log.Ctx(r.Context()).Error().Err(err).Msg("can't decompress request body")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer reader.Close()
+
+			body, err := io.ReadAll(io.LimitReader(reader, maxDecompressedBodySize+1))
+			if err != nil {
+				log.Ctx(r.Context()).Error().Err(err).Msg("can't decompress request body")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxDecompressedBodySize {
+				log.Ctx(r.Context()).Error().Int("limit", maxDecompressedBodySize).Msg("decompressed request body is too large")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		default:
+			log.Ctx(r.Context()).Error().Str("encoding", r.Header.Get("Content-Encoding")).Msg("unsupported request encoding")
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (a *api) updateMetricsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug().Msg("updating of metrics started")
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("updating of metrics started")
 
 	w.Header().Set("content-type", "application/json")
 
 	defer r.Body.Close()
 	respBody, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	err = a.service.ParseAndSave(respBody)
+	err = a.service.ParseAndSave(ctx, respBody)
 	if err != nil {
-		log.Error().Err(err)
+		log.Ctx(ctx).Error().Err(err)
 
 		switch err.Error() {
 		case "wrong metrics type":
@@ -70,28 +182,29 @@ func (a *api) updateMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug().Msg("parsed and saved")
+	log.Ctx(ctx).Debug().Msg("parsed and saved")
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("{}"))
 }
 
 func (a *api) getMetricsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug().Msg("getting of metrics started")
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("getting of metrics started")
 
 	w.Header().Set("content-type", "application/json")
 
 	defer r.Body.Close()
 	respBody, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	val, err := a.service.ParseAndGet(respBody)
+	val, err := a.service.ParseAndGet(ctx, respBody)
 	if err != nil {
-		log.Error().Err(err)
+		log.Ctx(ctx).Error().Err(err)
 
 		switch err.Error() {
 		case "wrong metrics type":
@@ -106,27 +219,29 @@ func (a *api) getMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug().Msg("parsed and get")
+	log.Ctx(ctx).Debug().Msg("parsed and get")
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(val)
 }
 
-func (a *api) rootHandler(w http.ResponseWriter, _ *http.Request) {
-	log.Debug().Msg("rootHandler started")
+func (a *api) rootHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("rootHandler started")
 
 	w.Header().Set("content-type", "text/html")
-	for _, val := range a.service.GetKnownMetrics() {
+	for _, val := range a.service.GetKnownMetrics(ctx) {
 		w.Write([]byte(val + "\n"))
 	}
 }
 
-func (a *api) pingDBHandler(w http.ResponseWriter, _ *http.Request) {
-	log.Debug().Msg("pingDBHandler started")
+func (a *api) pingDBHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("pingDBHandler started")
 
 	w.Header().Set("content-type", "text/html")
 
-	if !a.service.IsDBConnected() {
+	if !a.service.IsDBConnected(ctx) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -134,31 +249,60 @@ func (a *api) pingDBHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (a *api) dbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("dbStatsHandler started")
+
+	w.Header().Set("content-type", "application/json")
+
+	stats, err := a.service.GetDBStats(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err)
+
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("{}"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(stats)
+}
+
 func (a *api) updatesMetricsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug().Msg("updatesMetricsHandler started")
+	ctx := r.Context()
+	log.Ctx(ctx).Debug().Msg("updatesMetricsHandler started")
 
 	w.Header().Set("content-type", "application/json")
 
 	defer r.Body.Close()
 	respBody, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("{}"))
 		return
 	}
 
-	err = a.service.ParseAndSaveSeveral(respBody)
+	rejections, err := a.service.ParseAndSaveSeveral(ctx, respBody)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("{}"))
+		return
+	}
+	log.Ctx(ctx).Debug().Int("rejected", len(rejections)).Msg("parsed and saved several")
+
+	marshal, err := json.Marshal(metrics.UpdatesResult{Rejected: rejections})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+
+		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("{}"))
 		return
 	}
-	log.Debug().Msg("parsed and saved several")
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("{}"))
+	w.Write(marshal)
 }
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,6 +12,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -80,7 +86,7 @@ func Test_api_updateMetricsHandler(t *testing.T) {
 	})
 	assert.NoError(t, err)
 	serv := service.New("", myStorage)
-	a := api{serv}
+	a := api{service: serv}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			marshal, err := json.Marshal(metrics.Metric{
@@ -119,7 +125,7 @@ func Test_api_getMetricsHandler(t *testing.T) {
 	})
 	assert.NoError(t, err)
 	serv := service.New("", myStorage)
-	a := api{serv}
+	a := api{service: serv}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			value := int64(100)
@@ -172,7 +178,7 @@ func Test_api_rootHandler(t *testing.T) {
 	})
 	assert.NoError(t, err)
 	serv := service.New("", myStorage)
-	a := api{serv}
+	a := api{service: serv}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			value := int64(100)
@@ -202,3 +208,193 @@ func Test_api_rootHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_api_dbStatsHandler(t *testing.T) {
+	myStorage, err := storage.New(config.Config{
+		Address:       "",
+		StoreInterval: 0 * time.Second,
+		StoreFile:     "/tmp/devops-metrics-db.json",
+		Restore:       false,
+		Key:           "",
+		Database:      "",
+	})
+	assert.NoError(t, err)
+	serv := service.New("", myStorage)
+	a := api{service: serv}
+
+	request := httptest.NewRequest(http.MethodGet, "/debug/db", nil)
+	w := httptest.NewRecorder()
+	h := http.HandlerFunc(a.dbStatsHandler)
+	h.ServeHTTP(w, request)
+	result := w.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+}
+
+func Test_api_updatesMetricsHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		want       metrics.UpdatesResult
+	}{
+		{
+			name:       "all saved",
+			body:       `[{"id":"testUpdatesCounter","type":"counter","delta":1},{"id":"testUpdatesGauge","type":"gauge","value":2.5}]`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "some rejected",
+			body:       `[{"id":"testUpdatesCounter","type":"counter","delta":1},{"id":"testUpdatesGauge","type":"gauge"}]`,
+			statusCode: http.StatusOK,
+			want: metrics.UpdatesResult{Rejected: []metrics.Rejection{
+				{ID: "testUpdatesGauge", MType: "gauge", Reason: "wrong query"},
+			}},
+		},
+		{
+			name:       "wrong body",
+			body:       `{`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	myStorage, err := storage.New(config.Config{
+		Address:       "",
+		StoreInterval: 0 * time.Second,
+		StoreFile:     "/tmp/devops-metrics-db.json",
+		Restore:       false,
+		Key:           "",
+		Database:      "",
+	})
+	assert.NoError(t, err)
+	serv := service.New("", myStorage)
+	a := api{service: serv}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/updates/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h := http.HandlerFunc(a.updatesMetricsHandler)
+			h.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			var got metrics.UpdatesResult
+			assert.NoError(t, json.NewDecoder(result.Body).Decode(&got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_decompressRequest(t *testing.T) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	_, err := writer.Write([]byte(`[{"id":"Alloc","type":"gauge","value":1}]`))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	var bomb bytes.Buffer
+	writer = gzip.NewWriter(&bomb)
+	_, err = writer.Write(make([]byte, maxDecompressedBodySize+1))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		statusCode int
+	}{
+		{
+			name:       "plain",
+			body:       []byte(`[{"id":"Alloc","type":"gauge","value":1}]`),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "gzip",
+			encoding:   "gzip",
+			body:       gzipped.Bytes(),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "broken gzip",
+			encoding:   "gzip",
+			body:       []byte("not gzip"),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "too large when decompressed",
+			encoding:   "gzip",
+			body:       bomb.Bytes(),
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "unsupported",
+			encoding:   "br",
+			body:       []byte("whatever"),
+			statusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := decompressRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				got = string(body)
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			if len(tt.encoding) > 0 {
+				request.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, `[{"id":"Alloc","type":"gauge","value":1}]`, got)
+			}
+		})
+	}
+}
+
+func Test_requestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = defaultLogger }()
+
+	h := middleware.RequestID(requestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Ctx(r.Context()).Info().Msg("handled")
+	})))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, buf.String(), `"request_id":`)
+	assert.Contains(t, buf.String(), `"message":"handled"`)
+}
+
+func Test_api_RunShutdown(t *testing.T) {
+	myStorage, err := storage.New(config.Config{
+		StoreInterval: 0 * time.Second,
+		StoreFile:     "/tmp/devops-metrics-db.json",
+	})
+	assert.NoError(t, err)
+	a := New(service.New("", myStorage), time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx, "127.0.0.1:0")
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
@@ -1,13 +1,20 @@
 package api
 
+import (
+	"context"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
 type Service interface {
-	ParseAndSave([]byte) error
-	ParseAndGet([]byte) ([]byte, error)
-	GetKnownMetrics() []string
-	IsDBConnected() bool
-	ParseAndSaveSeveral([]byte) error
+	ParseAndSave(context.Context, []byte) error
+	ParseAndGet(context.Context, []byte) ([]byte, error)
+	GetKnownMetrics(context.Context) []string
+	IsDBConnected(context.Context) bool
+	GetDBStats(context.Context) ([]byte, error)
+	ParseAndSaveSeveral(context.Context, []byte) ([]metrics.Rejection, error)
 }
 
 type API interface {
-	Run(string2 string) error
+	Run(ctx context.Context, address string) error
 }
@@ -9,12 +9,33 @@ import (
 )
 
 type Config struct {
-	Address       string        `env:"ADDRESS"`
-	StoreInterval time.Duration `env:"STORE_INTERVAL"`
-	StoreFile     string        `env:"STORE_FILE"`
-	Restore       bool          `env:"RESTORE"`
-	Key           string        `env:"KEY"`
-	Database      string        `env:"DATABASE_DSN"`
+	Address         string        `env:"ADDRESS"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	StoreInterval   time.Duration `env:"STORE_INTERVAL"`
+	StoreFile       string        `env:"STORE_FILE"`
+	StoreKeep       int           `env:"STORE_KEEP"`
+	Restore         bool          `env:"RESTORE"`
+	RestoreFrom     string        `env:"RESTORE_FROM"`
+	Key             string        `env:"KEY"`
+	Database        string        `env:"DATABASE_DSN"`
+
+	DBMaxOpenConns     int           `env:"DATABASE_MAX_OPEN_CONNS"`
+	DBMaxIdleConns     int           `env:"DATABASE_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime  time.Duration `env:"DATABASE_CONN_MAX_LIFETIME"`
+	DBQueryTimeout     time.Duration `env:"DATABASE_QUERY_TIMEOUT"`
+	DBRetries          int           `env:"DATABASE_RETRIES"`
+	DBRetryBackoff     time.Duration `env:"DATABASE_RETRY_BACKOFF"`
+	DBSamplesRetention time.Duration `env:"DATABASE_SAMPLES_RETENTION"`
+
+	FileStorage   string        `env:"FILE_STORAGE_PATH"`
+	FileRetention time.Duration `env:"FILE_STORAGE_RETENTION"`
+	Redis         string        `env:"REDIS_ADDRESS"`
+
+	StorageBackend  string `env:"STORAGE_BACKEND"`
+	StorageFallback string `env:"STORAGE_FALLBACK"`
+
+	StorageFailover       bool          `env:"STORAGE_FAILOVER"`
+	FailoverCheckInterval time.Duration `env:"STORAGE_FAILOVER_CHECK_INTERVAL"`
 }
 
 func BuildConfig() (Config, error) {
@@ -26,11 +47,28 @@ func BuildConfig() (Config, error) {
 
 func (cfg *Config) buildFromFlags() {
 	flag.StringVar(&cfg.Address, "a", "127.0.0.1:8080", "address")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "timeout of graceful shutdown")
 	flag.DurationVar(&cfg.StoreInterval, "i", 300*time.Second, "store interval")
 	flag.BoolVar(&cfg.Restore, "r", true, "restore")
 	flag.StringVar(&cfg.StoreFile, "f", "/tmp/devops-metrics-db.json", "store file")
+	flag.IntVar(&cfg.StoreKeep, "store-keep", 0, "number of timestamped snapshots to keep")
+	flag.StringVar(&cfg.RestoreFrom, "restore-from", "", "snapshot file to restore from")
 	flag.StringVar(&cfg.Key, "k", "", "key")
 	flag.StringVar(&cfg.Database, "d", "", "database dsn")
+	flag.IntVar(&cfg.DBMaxOpenConns, "db-max-open-conns", 10, "max open database connections, 0 for unlimited")
+	flag.IntVar(&cfg.DBMaxIdleConns, "db-max-idle-conns", 5, "max idle database connections")
+	flag.DurationVar(&cfg.DBConnMaxLifetime, "db-conn-max-lifetime", 30*time.Minute, "max lifetime of database connection, 0 for unlimited")
+	flag.DurationVar(&cfg.DBQueryTimeout, "db-query-timeout", 5*time.Second, "database query timeout")
+	flag.IntVar(&cfg.DBRetries, "db-retries", 3, "retries of database query on transient errors")
+	flag.DurationVar(&cfg.DBRetryBackoff, "db-retry-backoff", 100*time.Millisecond, "initial backoff between database query retries")
+	flag.DurationVar(&cfg.DBSamplesRetention, "db-samples-retention", 24*time.Hour, "how long to keep history of metrics in database, 0 to keep forever")
+	flag.StringVar(&cfg.FileStorage, "file-storage", "", "embedded on-disk storage path")
+	flag.DurationVar(&cfg.FileRetention, "file-storage-retention", 24*time.Hour, "history retention of on-disk storage")
+	flag.StringVar(&cfg.Redis, "redis", "", "redis address")
+	flag.StringVar(&cfg.StorageBackend, "storage-backend", "", "storage backend: memory, file, postgres, redis")
+	flag.StringVar(&cfg.StorageFallback, "storage-fallback", "memory", "backend to use if the storage backend is unavailable, none to fail")
+	flag.BoolVar(&cfg.StorageFailover, "storage-failover", true, "buffer writes in memory while the database is unreachable")
+	flag.DurationVar(&cfg.FailoverCheckInterval, "storage-failover-check-interval", 1*time.Second, "interval between database availability checks while buffering writes")
 	flag.Parse()
 }
 
@@ -1,14 +1,20 @@
 package service
 
-import "github.com/nivanov045/metrics-monitor/internal/metrics"
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
 
 type Storage interface {
-	GetCounterMetrics(name string) (metrics.Counter, bool)
-	GetGaugeMetrics(name string) (metrics.Gauge, bool)
-	GetKnownMetrics() []string
-	IsDBConnected() bool
-	SetCounterMetrics(name string, val metrics.Counter) error
-	SetGaugeMetrics(name string, val metrics.Gauge) error
+	AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error
+	GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool)
+	GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool)
+	GetKnownMetrics(ctx context.Context) []string
+	IsDBConnected(ctx context.Context) bool
+	PoolStats() (sql.DBStats, bool)
+	SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error
 }
 
 type Crypto interface {
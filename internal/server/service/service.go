@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -26,100 +27,121 @@ const (
 	counter string = "counter"
 )
 
-// TODO: DRY ParseAndSave and ParseAndSaveSeveral
-func (ser *service) ParseAndSave(s []byte) error {
-	log.Debug().Interface("data", string(s)).Msg("started parse and save:")
+// errSaving means the storage failed to save the metric, so it may be saved
+// if it's sent again later.
+var errSaving = errors.New("problem in metrics saving")
+
+func (ser *service) ParseAndSave(ctx context.Context, s []byte) error {
+	log.Ctx(ctx).Debug().Interface("data", string(s)).Msg("started parse and save:")
 
 	var m metrics.Metric
 	err := json.Unmarshal(s, &m)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return errors.New("wrong query")
 	}
 
+	return ser.save(ctx, m)
+}
+
+// ParseAndSaveSeveral saves the batch of metrics. Metrics which can't be
+// saved don't prevent saving others and are returned as rejections; the ones
+// the storage failed to save are marked retryable.
+func (ser *service) ParseAndSaveSeveral(ctx context.Context, s []byte) ([]metrics.Rejection, error) {
+	log.Ctx(ctx).Debug().Interface("data", string(s)).Msg("ParseAndSaveSeveral started")
+
+	var mall []metrics.Metric
+	err := json.Unmarshal(s, &mall)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return nil, errors.New("wrong query")
+	}
+
+	var rejections []metrics.Rejection
+	for _, m := range mall {
+		err = ser.save(ctx, m)
+		if err != nil {
+			rejections = append(rejections, metrics.Rejection{
+				ID:        m.ID,
+				MType:     m.MType,
+				Reason:    err.Error(),
+				Retryable: errors.Is(err, errSaving),
+			})
+		}
+	}
+	return rejections, nil
+}
+
+func (ser *service) save(ctx context.Context, m metrics.Metric) error {
 	metricType := m.MType
 	metricName := m.ID
 
-	log.Debug().Interface("metricType", metricType).Interface("metricName", metricName)
+	log.Ctx(ctx).Debug().Interface("metricType", metricType).Interface("metricName", metricName)
 
 	switch metricType {
 	case gauge:
 		value := m.Value
 		if value == nil {
-			log.Error().Msg("gauge value is empty")
+			log.Ctx(ctx).Error().Msg("gauge value is empty")
 			return errors.New("wrong query")
 		}
 
 		if !ser.crypto.CheckHash(m) {
-			log.Error().Msg("wrong hash")
+			log.Ctx(ctx).Error().Msg("wrong hash")
 			return errors.New("wrong hash")
 		}
 
-		err = ser.storage.SetGaugeMetrics(metricName, metrics.Gauge(*value))
+		err := ser.storage.SetGaugeMetrics(ctx, metricName, metrics.Gauge(*value))
 		if err != nil {
-			log.Error().Err(err).Stack()
-			return errors.New("problem in metrics saving")
+			log.Ctx(ctx).Error().Err(err).Stack()
+			return errSaving
 		}
 	case counter:
 		if m.Delta == nil {
-			log.Error().Msg("counter delta is empty")
+			log.Ctx(ctx).Error().Msg("counter delta is empty")
 			return errors.New("wrong query")
 		}
 
 		value := *m.Delta
 
 		if !ser.crypto.CheckHash(m) {
-			log.Error().Msg("wrong hash")
+			log.Ctx(ctx).Error().Msg("wrong hash")
 			return errors.New("wrong hash")
 		}
 
-		exVal, isKnown := ser.storage.GetCounterMetrics(metricName)
-		if !isKnown {
-			log.Debug().Msg("new counter metric")
-
-			err = ser.storage.SetCounterMetrics(metricName, metrics.Counter(value))
-			if err != nil {
-				log.Error().Err(err).Stack()
-				return errors.New("problem in metrics saving")
-			}
-			return nil
-		}
-
-		log.Debug().Msg("update counter metric")
-
-		err = ser.storage.SetCounterMetrics(metricName, metrics.Counter(int64(exVal)+value))
+		err := ser.storage.AddCounterMetrics(ctx, metricName, metrics.Counter(value))
 		if err != nil {
-			log.Error().Err(err).Stack()
-			return errors.New("problem in metrics saving")
+			log.Ctx(ctx).Error().Err(err).Stack()
+			return errSaving
 		}
 	default:
-		log.Error().Msg("unknown metrics type")
+		log.Ctx(ctx).Error().Msg("unknown metrics type")
 		return errors.New("wrong metrics type")
 	}
 
 	return nil
 }
 
-func (ser *service) ParseAndGet(s []byte) ([]byte, error) {
-	log.Debug().Interface("data", string(s)).Msg("ParseAndGet started")
+func (ser *service) ParseAndGet(ctx context.Context, s []byte) ([]byte, error) {
+	log.Ctx(ctx).Debug().Interface("data", string(s)).Msg("ParseAndGet started")
 
 	var m metrics.Metric
 	err := json.Unmarshal(s, &m)
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return nil, errors.New("wrong query")
 	}
 
 	metricType := m.MType
 	metricName := m.ID
 
-	log.Debug().Interface("metricType", metricType).Interface("metricName", metricName)
+	log.Ctx(ctx).Debug().Interface("metricType", metricType).Interface("metricName", metricName)
 
 	switch metricType {
 	case gauge:
-		val, ok := ser.storage.GetGaugeMetrics(metricName)
+		val, ok := ser.storage.GetGaugeMetrics(ctx, metricName)
 		if !ok {
-			log.Error().Msg("service::ParseAndGet::info: no such gauge metrics")
+			log.Ctx(ctx).Error().Msg("service::ParseAndGet::info: no such gauge metrics")
 			return nil, errors.New("no such metric")
 		}
 
@@ -132,15 +154,15 @@ func (ser *service) ParseAndGet(s []byte) ([]byte, error) {
 
 		marshal, err := json.Marshal(m)
 		if err != nil {
-			log.Error().Err(err).Stack()
+			log.Ctx(ctx).Error().Err(err).Stack()
 			return nil, err
 		}
 
 		return marshal, nil
 	case counter:
-		val, ok := ser.storage.GetCounterMetrics(metricName)
+		val, ok := ser.storage.GetCounterMetrics(ctx, metricName)
 		if !ok {
-			log.Error().Msg("no such counter metrics")
+			log.Ctx(ctx).Error().Msg("no such counter metrics")
 			return nil, errors.New("no such metric")
 		}
 
@@ -153,91 +175,37 @@ func (ser *service) ParseAndGet(s []byte) ([]byte, error) {
 
 		marshal, err := json.Marshal(m)
 		if err != nil {
-			log.Error().Err(err).Stack()
+			log.Ctx(ctx).Error().Err(err).Stack()
 			return nil, err
 		}
 
 		return marshal, nil
 	default:
-		log.Error().Msg("unknown metrics type")
+		log.Ctx(ctx).Error().Msg("unknown metrics type")
 
 		return nil, errors.New("wrong metrics type")
 	}
 }
 
-func (ser *service) GetKnownMetrics() []string {
-	return ser.storage.GetKnownMetrics()
+func (ser *service) GetKnownMetrics(ctx context.Context) []string {
+	return ser.storage.GetKnownMetrics(ctx)
 }
 
-func (ser *service) IsDBConnected() bool {
-	return ser.storage.IsDBConnected()
+func (ser *service) IsDBConnected(ctx context.Context) bool {
+	return ser.storage.IsDBConnected(ctx)
 }
 
-func (ser *service) ParseAndSaveSeveral(s []byte) error {
-	log.Debug().Interface("data", string(s)).Msg("ParseAndSaveSeveral started")
+func (ser *service) GetDBStats(ctx context.Context) ([]byte, error) {
+	stats, ok := ser.storage.PoolStats()
+	if !ok {
+		return nil, errors.New("no connection pool")
+	}
 
-	var mall []metrics.Metric
-	err := json.Unmarshal(s, &mall)
+	marshal, err := json.Marshal(stats)
 	if err != nil {
-		log.Error().Err(err).Stack()
-		return errors.New("wrong query")
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return nil, err
 	}
 
-	for _, m := range mall {
-		metricType := m.MType
-		metricName := m.ID
-
-		log.Debug().Interface("metricType", metricType).Interface("metricName", metricName)
-
-		switch metricType {
-		case gauge:
-			value := m.Value
-			if value == nil {
-				log.Error().Msg("gauge value is empty")
-				continue
-			}
-
-			if !ser.crypto.CheckHash(m) {
-				log.Error().Msg("wrong hash")
-				continue
-			}
-
-			err = ser.storage.SetGaugeMetrics(metricName, metrics.Gauge(*value))
-			if err != nil {
-				log.Error().Err(err).Stack()
-				continue
-			}
-		case counter:
-			if m.Delta == nil {
-				log.Error().Msg("counter delta is empty")
-				continue
-			}
-
-			value := *m.Delta
-
-			if !ser.crypto.CheckHash(m) {
-				log.Error().Msg("wrong hash")
-				continue
-			}
-
-			exVal, ok := ser.storage.GetCounterMetrics(metricName)
-			if !ok {
-				log.Debug().Msg("new counter metric")
-				err = ser.storage.SetCounterMetrics(metricName, metrics.Counter(value))
-				if err != nil {
-					log.Error().Err(err).Stack()
-				}
-				continue
-			}
-			log.Debug().Msg("update counter metric")
-			err = ser.storage.SetCounterMetrics(metricName, metrics.Counter(int64(exVal)+value))
-			if err != nil {
-				log.Error().Err(err).Stack()
-			}
-		default:
-			log.Error().Msg("unknown metrics type")
-			continue
-		}
-	}
-	return nil
+	return marshal, nil
 }
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 	"time"
@@ -69,7 +71,7 @@ func Test_service_ParseAndSave(t *testing.T) {
 			}
 			marshal, err := json.Marshal(v)
 			assert.NoError(t, err)
-			err = ser.ParseAndSave(marshal)
+			err = ser.ParseAndSave(context.Background(), marshal)
 			assert.NoError(t, err)
 		})
 	}
@@ -130,7 +132,7 @@ func Test_service_ParseAndGet(t *testing.T) {
 			}
 			marshal, err := json.Marshal(v)
 			assert.NoError(t, err)
-			err = ser.ParseAndSave(marshal)
+			err = ser.ParseAndSave(context.Background(), marshal)
 			assert.NoError(t, err)
 			marshalGet, err := json.Marshal(metrics.Metric{
 				ID:    tt.data.name,
@@ -139,7 +141,7 @@ func Test_service_ParseAndGet(t *testing.T) {
 				Value: nil,
 			})
 			assert.NoError(t, err)
-			got, err := ser.ParseAndGet(marshalGet)
+			got, err := ser.ParseAndGet(context.Background(), marshalGet)
 			assert.NoError(t, err)
 			assert.Equal(t, got, marshal)
 		})
@@ -196,12 +198,81 @@ func Test_service_GetKnownMetrics(t *testing.T) {
 					Value: &val.valueFloat,
 				})
 				assert.NoError(t, err)
-				err = ser.ParseAndSave(marshal)
+				err = ser.ParseAndSave(context.Background(), marshal)
 				assert.NoError(t, err)
 			}
-			if got := ser.GetKnownMetrics(); !reflect.DeepEqual(got, tt.want) {
+			if got := ser.GetKnownMetrics(context.Background()); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("service.GetKnownMetrics() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_service_ParseAndSaveSeveral(t *testing.T) {
+	myStorage, err := storage.New(config.Config{
+		Address:       "",
+		StoreInterval: 0 * time.Second,
+		StoreFile:     "/tmp/devops-metrics-db.json",
+		Restore:       false,
+		Key:           "",
+		Database:      "",
+	})
+	assert.NoError(t, err)
+	ser := service{myStorage, crypto.New(""), false}
+
+	gaugeVal := 1.5
+	counterVal := int64(3)
+	marshal, err := json.Marshal([]metrics.Metric{
+		{ID: "TestSeveralGauge", MType: "gauge", Value: &gaugeVal},
+		{ID: "TestSeveralEmpty", MType: "gauge"},
+		{ID: "TestSeveralCounter", MType: "counter", Delta: &counterVal},
+		{ID: "TestSeveralUnknown", MType: "unknown", Delta: &counterVal},
+	})
+	assert.NoError(t, err)
+
+	rejections, err := ser.ParseAndSaveSeveral(context.Background(), marshal)
+	assert.NoError(t, err)
+	assert.Equal(t, []metrics.Rejection{
+		{ID: "TestSeveralEmpty", MType: "gauge", Reason: "wrong query"},
+		{ID: "TestSeveralUnknown", MType: "unknown", Reason: "wrong metrics type"},
+	}, rejections)
+
+	val, ok := myStorage.GetCounterMetrics(context.Background(), "TestSeveralCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(3), val)
+
+	_, err = ser.ParseAndSaveSeveral(context.Background(), []byte("not json"))
+	assert.Error(t, err)
+}
+
+// failingStorage fails to save counters.
+type failingStorage struct {
+	Storage
+}
+
+func (s failingStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	return errors.New("connection refused")
+}
+
+func Test_service_ParseAndSaveSeveral_StorageFailure(t *testing.T) {
+	myStorage, err := storage.New(config.Config{
+		StoreInterval: 0 * time.Second,
+		StoreFile:     "/tmp/devops-metrics-db.json",
+	})
+	assert.NoError(t, err)
+	ser := service{failingStorage{myStorage}, crypto.New(""), false}
+
+	counterVal := int64(3)
+	marshal, err := json.Marshal([]metrics.Metric{
+		{ID: "TestFailingCounter", MType: "counter", Delta: &counterVal},
+		{ID: "TestFailingEmpty", MType: "gauge"},
+	})
+	assert.NoError(t, err)
+
+	rejections, err := ser.ParseAndSaveSeveral(context.Background(), marshal)
+	assert.NoError(t, err)
+	assert.Equal(t, []metrics.Rejection{
+		{ID: "TestFailingCounter", MType: "counter", Reason: "problem in metrics saving", Retryable: true},
+		{ID: "TestFailingEmpty", MType: "gauge", Reason: "wrong query"},
+	}, rejections)
+}
@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"runtime"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -12,185 +13,391 @@ import (
 	"github.com/nivanov045/metrics-monitor/internal/metrics"
 )
 
-const checkColumnQuery = `SELECT EXISTS (SELECT column_name FROM information_schema.columns WHERE table_name='metrics' and column_name=$1);`
-const checkTableQuery = `SELECT EXISTS (SELECT FROM information_schema.tables WHERE  table_name = 'metrics');`
-const createTableQuery = `CREATE TABLE metrics (mytype text, myid text, myvalue double precision, delta bigint, uid text UNIQUE);`
-const dropTableQuery = `DROP TABLE metrics;`
-const insertCounterMetricQuery = `INSERT INTO metrics(mytype, myid, delta, uid) VALUES ('counter', $1, $2, $3) ON CONFLICT (uid) DO UPDATE SET delta=$2;`
-const insertGaugeMetricQuery = `INSERT INTO metrics(mytype, myid, myvalue, uid) VALUES ('gauge', $1, $2, $3) ON CONFLICT (uid) DO UPDATE SET myvalue=$2;`
-const getAllMetricsQuery = `SELECT DISTINCT myid FROM metrics`
-const getCounterMetricQuery = `SELECT delta FROM metrics WHERE mytype='counter' AND myid=$1;`
-const getGaugeMetricQuery = `SELECT myvalue FROM metrics WHERE mytype='gauge' AND myid=$1;`
+// Every write appends a sample to the series of the metric, reads return
+// the latest sample. Series are created on the first write and their ids are
+// cached, so writes don't touch the series table.
+const insertSeriesQuery = `INSERT INTO series (name, type) VALUES ($1, $2)
+	ON CONFLICT (name, type, labels) DO NOTHING RETURNING id;`
+const getSeriesQuery = `SELECT id FROM series WHERE name = $1 AND type = $2 AND labels = '{}'::jsonb;`
+const insertCounterMetricQuery = `INSERT INTO samples (series_id, delta) VALUES ($1, $2)
+	ON CONFLICT (series_id, ts) DO UPDATE SET delta = EXCLUDED.delta;`
+const insertGaugeMetricQuery = `INSERT INTO samples (series_id, value) VALUES ($1, $2)
+	ON CONFLICT (series_id, ts) DO UPDATE SET value = EXCLUDED.value;`
+
+// The counter is incremented in the transaction holding the lock of its
+// series, so concurrent increments of several servers aren't lost.
+const lockSeriesQuery = `SELECT id FROM series WHERE id = $1 FOR UPDATE;`
+const addCounterMetricQuery = `INSERT INTO samples (series_id, delta)
+	SELECT $1, COALESCE((SELECT delta FROM samples WHERE series_id = $1 ORDER BY ts DESC LIMIT 1), 0) + $2
+	ON CONFLICT (series_id, ts) DO UPDATE SET delta = EXCLUDED.delta;`
+const getAllMetricsQuery = `SELECT DISTINCT name FROM series;`
+const getCounterMetricQuery = `SELECT sm.delta FROM samples sm JOIN series s ON s.id = sm.series_id
+	WHERE s.name = $1 AND s.type = 'counter' AND s.labels = '{}'::jsonb
+	ORDER BY sm.ts DESC LIMIT 1;`
+const getGaugeMetricQuery = `SELECT sm.value FROM samples sm JOIN series s ON s.id = sm.series_id
+	WHERE s.name = $1 AND s.type = 'gauge' AND s.labels = '{}'::jsonb
+	ORDER BY sm.ts DESC LIMIT 1;`
+
+// Samples older than the retention are deleted, except the latest sample of
+// each series which holds the current value of the metric.
+const pruneSamplesQuery = `DELETE FROM samples sm WHERE sm.ts < $1
+	AND sm.ts < (SELECT max(l.ts) FROM samples l WHERE l.series_id = sm.series_id);`
+
+const defaultQueryTimeout = 5 * time.Second
+
+// samplesPruneInterval is a period of deleting samples out of the retention.
+const samplesPruneInterval = 10 * time.Minute
+
+var (
+	ErrNoDSN              = errors.New("database DSN isn't set")
+	ErrCantCreateDatabase = errors.New("can't create database")
+	ErrCantMigrate        = errors.New("can't migrate database schema")
+)
+
+// Options tune the connection pool and queries of DBStorage.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	QueryTimeout    time.Duration
+	// Retries is a number of additional attempts of the query
+	// failed with a transient error.
+	Retries      int
+	RetryBackoff time.Duration
+	// SamplesRetention is how long the history of metrics is kept,
+	// 0 keeps it forever.
+	SamplesRetention time.Duration
+}
 
 type DBStorage struct {
 	databasePath string
 	db           *sql.DB
+	opts         Options
+
+	seriesMu sync.Mutex
+	series   map[seriesKey]int64
+
+	stopPruning chan struct{}
+	pruning     sync.WaitGroup
+}
+
+type seriesKey struct {
+	name  string
+	mtype string
 }
 
-func New(databasePath string) (*DBStorage, error) {
+func New(databasePath string, opts Options) (*DBStorage, error) {
 	log.Debug().Msg("DBStorage started")
+	if len(databasePath) == 0 {
+		return nil, ErrNoDSN
+	}
+	if opts.QueryTimeout <= 0 {
+		opts.QueryTimeout = defaultQueryTimeout
+	}
 	var res = &DBStorage{
 		databasePath: databasePath,
+		opts:         opts,
+		series:       map[seriesKey]int64{},
 	}
 
 	var err error
 	res.db, err = sql.Open("postgres", databasePath)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, errors.New(`can't create database'`)
+		return nil, ErrCantCreateDatabase
 	}
-	runtime.SetFinalizer(res, func(s *DBStorage) {
-		log.Info().Msg("finalizer started")
-		defer s.db.Close()
-	})
+	res.db.SetMaxOpenConns(opts.MaxOpenConns)
+	res.db.SetMaxIdleConns(opts.MaxIdleConns)
+	res.db.SetConnMaxLifetime(opts.ConnMaxLifetime)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	var value bool
-	row := res.db.QueryRowContext(ctx, checkTableQuery)
-	err = row.Scan(&value)
+	err = res.prepare()
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, errors.New(`can't create database'`)
+		return nil, err
 	}
 
-	if !value {
-		_, err = res.db.Exec(createTableQuery)
-		if err != nil {
-			log.Error().Err(err).Stack()
-			return nil, errors.New(`can't create database'`)
-		}
-		return res, nil
+	if opts.SamplesRetention > 0 {
+		res.stopPruning = make(chan struct{})
+		res.pruning.Add(1)
+		go res.pruneSamplesPeriodically()
 	}
 
-	tableIsOk := true
-	for _, name := range []string{"mytype", "myid", "myvalue", "delta", "uid"} {
-		var value bool
-		row := res.db.QueryRowContext(ctx, checkColumnQuery, name)
-		err = row.Scan(&value)
+	return res, nil
+}
+
+// prepare checks the connection to the database and migrates its schema.
+// Only failures to connect are reported as ErrCantCreateDatabase: the broken
+// schema must be fixed rather than replaced by another storage.
+func (s *DBStorage) prepare() error {
+	err := s.withRetry(context.Background(), func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.QueryTimeout)
+		defer cancel()
+		return s.db.PingContext(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCantCreateDatabase, err)
+	}
+
+	err = s.withRetry(context.Background(), func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return migrate(ctx, s.db)
+	})
+	if isTransient(err) {
+		return fmt.Errorf("%w: %v", ErrCantCreateDatabase, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCantMigrate, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) pruneSamplesPeriodically() {
+	defer s.pruning.Done()
+
+	ticker := time.NewTicker(samplesPruneInterval)
+	defer ticker.Stop()
+	for {
+		_, err := s.pruneSamples(context.Background())
 		if err != nil {
-			log.Error().Err(err).Stack()
-			return nil, errors.New(`can't create database'`)
+			log.Error().Err(err).Msg("can't delete old samples")
 		}
-		if !value {
-			tableIsOk = false
-			break
+
+		select {
+		case <-s.stopPruning:
+			return
+		case <-ticker.C:
 		}
 	}
+}
 
-	if !tableIsOk {
-		log.Error().Err(err).Stack()
-		_, err = res.db.Exec(dropTableQuery)
+// pruneSamples deletes samples older than the retention and returns their
+// number.
+func (s *DBStorage) pruneSamples(ctx context.Context) (int64, error) {
+	var res int64
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
+
+		result, err := s.db.ExecContext(ctx, pruneSamplesQuery, time.Now().Add(-s.opts.SamplesRetention))
 		if err != nil {
-			log.Error().Err(err).Stack()
-			return nil, errors.New(`can't create database'`)
+			return err
 		}
+		res, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Ctx(ctx).Debug().Int64("deleted", res).Msg("old samples deleted")
+	return res, nil
+}
+
+func (s *DBStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("SetCounterMetrics started")
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
 
-		_, err = res.db.Exec(createTableQuery)
+		id, err := s.seriesID(ctx, name, "counter")
 		if err != nil {
-			log.Error().Err(err).Stack()
-			return nil, errors.New(`can't create database'`)
+			return err
 		}
-	} else {
-		log.Debug().Msg("existing table is OK")
+
+		_, err = s.db.ExecContext(ctx, insertCounterMetricQuery, id, val)
+		if isForeignKeyViolation(err) {
+			// The series is deleted since it was cached.
+			s.forgetSeries(name, "counter")
+		}
+		return err
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return err
 	}
 
-	return res, nil
+	return nil
 }
 
-func (s *DBStorage) SetCounterMetrics(name string, val metrics.Counter) error {
-	log.Debug().Msg("SetCounterMetrics started")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// AddCounterMetrics increments the counter by delta atomically. The counter
+// is created if it isn't known yet.
+func (s *DBStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("AddCounterMetrics started")
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
+
+		id, err := s.seriesID(ctx, name, "counter")
+		if err != nil {
+			return err
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
 
-	_, err := s.db.ExecContext(ctx, insertCounterMetricQuery, name, val, "counter"+name)
+		err = tx.QueryRowContext(ctx, lockSeriesQuery, id).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The series is deleted since it was cached.
+			s.forgetSeries(name, "counter")
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, addCounterMetricQuery, id, delta)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return err
 	}
 
 	return nil
 }
 
-func (s *DBStorage) GetCounterMetrics(name string) (metrics.Counter, bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// seriesID returns the id of the series of the metric, creating the series
+// if it doesn't exist.
+func (s *DBStorage) seriesID(ctx context.Context, name string, mtype string) (int64, error) {
+	key := seriesKey{name: name, mtype: mtype}
+	s.seriesMu.Lock()
+	id, ok := s.series[key]
+	s.seriesMu.Unlock()
+	if ok {
+		return id, nil
+	}
 
+	err := s.db.QueryRowContext(ctx, insertSeriesQuery, name, mtype).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The series exists already.
+		err = s.db.QueryRowContext(ctx, getSeriesQuery, name, mtype).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	s.seriesMu.Lock()
+	s.series[key] = id
+	s.seriesMu.Unlock()
+	return id, nil
+}
+
+func (s *DBStorage) forgetSeries(name string, mtype string) {
+	s.seriesMu.Lock()
+	delete(s.series, seriesKey{name: name, mtype: mtype})
+	s.seriesMu.Unlock()
+}
+
+func (s *DBStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
 	var value int64
-	row := s.db.QueryRowContext(ctx, getCounterMetricQuery, name)
-	err := row.Scan(&value)
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
+
+		return s.db.QueryRowContext(ctx, getCounterMetricQuery, name).Scan(&value)
+	})
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return 0, false
 	}
 
 	return metrics.Counter(value), true
 }
 
-func (s *DBStorage) SetGaugeMetrics(name string, val metrics.Gauge) error {
-	log.Debug().Msg("SetGaugeMetrics started")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (s *DBStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	log.Ctx(ctx).Debug().Msg("SetGaugeMetrics started")
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
+
+		id, err := s.seriesID(ctx, name, "gauge")
+		if err != nil {
+			return err
+		}
 
-	_, err := s.db.ExecContext(ctx, insertGaugeMetricQuery, name, val, "gauge"+name)
+		_, err = s.db.ExecContext(ctx, insertGaugeMetricQuery, id, val)
+		if isForeignKeyViolation(err) {
+			// The series is deleted since it was cached.
+			s.forgetSeries(name, "gauge")
+		}
+		return err
+	})
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return err
 	}
 
 	return nil
 }
 
-func (s *DBStorage) GetGaugeMetrics(name string) (metrics.Gauge, bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+func (s *DBStorage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
 	var value float64
-	row := s.db.QueryRowContext(ctx, getGaugeMetricQuery, name)
-	err := row.Scan(&value)
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
+
+		return s.db.QueryRowContext(ctx, getGaugeMetricQuery, name).Scan(&value)
+	})
 	if err != nil {
-		log.Error().Err(err).Stack()
+		log.Ctx(ctx).Error().Err(err).Stack()
 		return 0, false
 	}
 
 	return metrics.Gauge(value), true
 }
 
-func (s *DBStorage) GetKnownMetrics() []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+func (s *DBStorage) GetKnownMetrics(ctx context.Context) []string {
 	var res []string
-	rows, err := s.db.QueryContext(ctx, getAllMetricsQuery)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		return res
-	}
-
-	if rows.Err() != nil {
-		log.Error().Err(err).Stack()
-		return res
-	}
+	err := s.withRetry(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.QueryTimeout)
+		defer cancel()
 
-	for rows.Next() {
-		var val string
-		err := rows.Scan(&val)
+		res = nil
+		rows, err := s.db.QueryContext(ctx, getAllMetricsQuery)
 		if err != nil {
-			log.Error().Err(err).Stack()
-			continue
+			return err
 		}
-		res = append(res, val)
+		defer rows.Close()
+
+		for rows.Next() {
+			var val string
+			err := rows.Scan(&val)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Stack()
+				continue
+			}
+			res = append(res, val)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
 	}
 
 	return res
 }
 
-func (s *DBStorage) IsDBConnected() bool {
+func (s *DBStorage) Close() error {
+	if s.stopPruning != nil {
+		close(s.stopPruning)
+		s.pruning.Wait()
+	}
+	return s.db.Close()
+}
+
+func (s *DBStorage) IsDBConnected(ctx context.Context) bool {
 	if s.db == nil {
 		return false
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
 	if err := s.db.PingContext(ctx); err != nil {
@@ -199,3 +406,8 @@ func (s *DBStorage) IsDBConnected() bool {
 
 	return true
 }
+
+// Stats returns statistics of the connection pool.
+func (s *DBStorage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
@@ -0,0 +1,134 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBStorage_pruneSamples(t *testing.T) {
+	fake := newFakeDB()
+	fake.affected = 42
+	s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second, SamplesRetention: time.Hour}}
+	defer s.Close()
+
+	deleted, err := s.pruneSamples(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), deleted)
+	assert.Equal(t, []string{pruneSamplesQuery}, fake.executed)
+	require.Len(t, fake.args, 1)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), fake.args[0].Value.(time.Time), time.Minute)
+}
+
+func TestDBStorage_pruneSamplesFailed(t *testing.T) {
+	fake := newFakeDB()
+	fake.failOn = "DELETE FROM samples"
+	s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second, SamplesRetention: time.Hour}}
+	defer s.Close()
+
+	_, err := s.pruneSamples(context.Background())
+	assert.ErrorIs(t, err, errFakeQuery)
+}
+
+func TestDBStorage_CloseStopsPruning(t *testing.T) {
+	fake := newFakeDB()
+	s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second, SamplesRetention: time.Hour}}
+	s.stopPruning = make(chan struct{})
+	s.pruning.Add(1)
+	go s.pruneSamplesPeriodically()
+
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.executed) > 0
+	}, time.Second, 10*time.Millisecond, "samples must be pruned on start")
+	require.NoError(t, s.Close())
+}
+
+func TestDBStorage_prepare(t *testing.T) {
+	tests := []struct {
+		name       string
+		connectErr error
+		failOn     string
+		wantErr    error
+	}{
+		{name: "migrated", wantErr: nil},
+		{name: "connection refused", connectErr: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), wantErr: ErrCantCreateDatabase},
+		{name: "migration failed", failOn: "CREATE TABLE IF NOT EXISTS series", wantErr: ErrCantMigrate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeDB()
+			fake.connectErr = tt.connectErr
+			fake.failOn = tt.failOn
+			s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second}}
+			defer s.Close()
+
+			err := s.prepare()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == ErrCantMigrate {
+				assert.NotErrorIs(t, err, ErrCantCreateDatabase, "broken schema mustn't look like connection failure")
+			}
+		})
+	}
+}
+
+func TestDBStorage_SetMetricsCachesSeries(t *testing.T) {
+	tests := []struct {
+		name string
+		rows map[string][]driver.Value
+		want []string
+	}{
+		{
+			name: "new series",
+			rows: map[string][]driver.Value{insertSeriesQuery: {int64(7)}},
+			want: []string{insertSeriesQuery, insertGaugeMetricQuery, insertGaugeMetricQuery},
+		},
+		{
+			name: "existing series",
+			rows: map[string][]driver.Value{getSeriesQuery: {int64(7)}},
+			want: []string{insertSeriesQuery, getSeriesQuery, insertGaugeMetricQuery, insertGaugeMetricQuery},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeDB()
+			fake.rows = tt.rows
+			s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second}, series: map[seriesKey]int64{}}
+			defer s.Close()
+
+			require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", 1.5))
+			require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", 2.5))
+			assert.Equal(t, tt.want, fake.executed)
+			require.Len(t, fake.args, 2)
+			assert.Equal(t, int64(7), fake.args[0].Value)
+		})
+	}
+}
+
+func TestDBStorage_AddCounterMetrics(t *testing.T) {
+	fake := newFakeDB()
+	fake.rows = map[string][]driver.Value{
+		insertSeriesQuery: {int64(7)},
+		lockSeriesQuery:   {int64(7)},
+	}
+	s := &DBStorage{db: fake.open(), opts: Options{QueryTimeout: time.Second}, series: map[seriesKey]int64{}}
+	defer s.Close()
+
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 3))
+	assert.Equal(t, []string{insertSeriesQuery, lockSeriesQuery, addCounterMetricQuery}, fake.executed)
+	require.Len(t, fake.args, 2)
+	assert.Equal(t, int64(7), fake.args[0].Value)
+	assert.Equal(t, int64(3), fake.args[1].Value)
+	assert.Equal(t, 1, fake.commits)
+}
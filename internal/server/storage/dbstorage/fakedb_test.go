@@ -0,0 +1,178 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDB is a database/sql driver which understands only the queries of
+// migrations: it keeps applied versions of migrations, records executed
+// statements and fails statements containing failOn. Other statements
+// affect the given number of rows, and queries return the row set in rows
+// or no rows. Connecting fails with connectErr.
+type fakeDB struct {
+	mu         sync.Mutex
+	applied    map[int]bool
+	failOn     string
+	connectErr error
+	rows       map[string][]driver.Value
+	affected   int64
+	executed   []string
+	args       []driver.NamedValue
+
+	commits   int
+	rollbacks int
+}
+
+var errFakeQuery = errors.New("fake query failed")
+
+func newFakeDB(applied ...int) *fakeDB {
+	res := &fakeDB{applied: map[int]bool{}, rows: map[string][]driver.Value{}}
+	for _, version := range applied {
+		res.applied[version] = true
+	}
+	return res
+}
+
+// open returns *sql.DB working on the fake database.
+func (d *fakeDB) open() *sql.DB {
+	return sql.OpenDB(d)
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	if d.connectErr != nil {
+		return nil, d.connectErr
+	}
+	return &fakeConn{db: d}, nil
+}
+
+func (d *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+// migrationsUp returns statements of migrations which were executed.
+func (d *fakeDB) migrationsUp() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var res []string
+	for _, query := range d.executed {
+		for _, m := range migrations {
+			if query == m.up {
+				res = append(res, m.name)
+			}
+		}
+	}
+	return res
+}
+
+func (d *fakeDB) isApplied(version int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.applied[version]
+}
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements aren't supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c}
+	return c.tx, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.executed = append(c.db.executed, query)
+	c.db.args = args
+	if len(c.db.failOn) > 0 && strings.Contains(query, c.db.failOn) {
+		return nil, errFakeQuery
+	}
+	if query == insertMigrationQuery {
+		// The version is recorded only if the transaction is committed.
+		c.tx.inserted = append(c.tx.inserted, int(args[0].Value.(int64)))
+	}
+	return driver.RowsAffected(c.db.affected), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.executed = append(c.db.executed, query)
+	if len(c.db.failOn) > 0 && strings.Contains(query, c.db.failOn) {
+		return nil, errFakeQuery
+	}
+	if query == checkMigrationQuery {
+		return &fakeRows{values: []driver.Value{c.db.applied[int(args[0].Value.(int64))]}}, nil
+	}
+	return &fakeRows{values: c.db.rows[query]}, nil
+}
+
+type fakeTx struct {
+	conn     *fakeConn
+	inserted []int
+}
+
+func (tx *fakeTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.commits++
+	for _, version := range tx.inserted {
+		db.applied[version] = true
+	}
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.rollbacks++
+	tx.conn.tx = nil
+	return nil
+}
+
+// fakeRows is a single row of the single column or no rows if there are no
+// values.
+type fakeRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.read || len(r.values) == 0 {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
@@ -0,0 +1,145 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migration is a single schema change. Migrations are applied in order of
+// their versions, each in its own transaction, and are never edited once
+// released: to change the schema append a new migration.
+type migration struct {
+	version int
+	name    string
+	up      string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create metrics table",
+		up:      `CREATE TABLE IF NOT EXISTS metrics (mytype text, myid text, myvalue double precision, delta bigint, uid text UNIQUE);`,
+	},
+	{
+		version: 2,
+		name:    "add missing metrics columns",
+		up: `ALTER TABLE metrics
+			ADD COLUMN IF NOT EXISTS mytype text,
+			ADD COLUMN IF NOT EXISTS myid text,
+			ADD COLUMN IF NOT EXISTS myvalue double precision,
+			ADD COLUMN IF NOT EXISTS delta bigint,
+			ADD COLUMN IF NOT EXISTS uid text UNIQUE;`,
+	},
+	{
+		version: 3,
+		name:    "normalize metrics into series and samples",
+		up: `DO $$ BEGIN
+				CREATE TYPE metric_type AS ENUM ('gauge', 'counter');
+			EXCEPTION WHEN duplicate_object THEN NULL;
+			END $$;
+
+			CREATE TABLE IF NOT EXISTS series (
+				id bigserial PRIMARY KEY,
+				name text NOT NULL,
+				type metric_type NOT NULL,
+				labels jsonb NOT NULL DEFAULT '{}'::jsonb,
+				UNIQUE (name, type, labels)
+			);
+			CREATE INDEX IF NOT EXISTS series_name_idx ON series (name);
+			CREATE INDEX IF NOT EXISTS series_labels_idx ON series USING gin (labels);
+
+			CREATE TABLE IF NOT EXISTS samples (
+				series_id bigint NOT NULL REFERENCES series (id) ON DELETE CASCADE,
+				ts timestamptz NOT NULL DEFAULT clock_timestamp(),
+				value double precision,
+				delta bigint,
+				PRIMARY KEY (series_id, ts)
+			);
+			CREATE INDEX IF NOT EXISTS samples_ts_idx ON samples (ts);
+
+			INSERT INTO series (name, type)
+				SELECT DISTINCT myid, mytype::metric_type FROM metrics
+				WHERE myid IS NOT NULL AND mytype IN ('gauge', 'counter')
+				ON CONFLICT DO NOTHING;
+			INSERT INTO samples (series_id, value, delta)
+				SELECT s.id, m.myvalue, m.delta FROM metrics m
+				JOIN series s ON s.name = m.myid AND s.type::text = m.mytype AND s.labels = '{}'::jsonb
+				ON CONFLICT DO NOTHING;
+
+			ALTER TABLE metrics RENAME TO metrics_legacy;`,
+	},
+	{
+		version: 4,
+		name:    "drop empty legacy metrics table",
+		up: `DO $$ BEGIN
+				IF to_regclass('metrics_legacy') IS NOT NULL THEN
+					IF NOT EXISTS (SELECT FROM metrics_legacy) THEN
+						DROP TABLE metrics_legacy;
+					END IF;
+				END IF;
+			END $$;`,
+	},
+}
+
+// migrationsLockID is a key of the advisory lock which prevents several
+// servers from migrating the same database simultaneously.
+const migrationsLockID = 4504501
+
+const createMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL DEFAULT now());`
+const lockMigrationsQuery = `SELECT pg_advisory_xact_lock($1);`
+const checkMigrationQuery = `SELECT EXISTS (SELECT FROM schema_migrations WHERE version=$1);`
+const insertMigrationQuery = `INSERT INTO schema_migrations(version, name) VALUES ($1, $2);`
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, createMigrationsTableQuery)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		err = applyMigration(ctx, db, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockMigrationsQuery, migrationsLockID)
+	if err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, checkMigrationQuery, m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	log.Ctx(ctx).Info().Int("version", m.version).Str("name", m.name).Msg("applying migration")
+	_, err = tx.ExecContext(ctx, m.up)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, insertMigrationQuery, m.version, m.name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
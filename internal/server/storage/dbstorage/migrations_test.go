@@ -0,0 +1,90 @@
+package dbstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_migrations_Ordered(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "migrations must have consecutive versions")
+		assert.NotEmpty(t, m.name)
+		assert.NotEmpty(t, m.up)
+	}
+}
+
+func Test_migrate(t *testing.T) {
+	var all []string
+	for _, m := range migrations {
+		all = append(all, m.name)
+	}
+
+	tests := []struct {
+		name    string
+		applied []int
+		want    []string
+	}{
+		{
+			// The database of the server which didn't version its schema
+			// has the legacy metrics table only, so all migrations apply.
+			name: "legacy database",
+			want: all,
+		},
+		{
+			name:    "partially migrated database",
+			applied: []int{1, 2},
+			want:    all[2:],
+		},
+		{
+			name:    "database migrated before the legacy table was dropped",
+			applied: []int{1, 2, 3},
+			want:    all[3:],
+		},
+		{
+			name:    "migrated database",
+			applied: []int{1, 2, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeDB(tt.applied...)
+			db := fake.open()
+			defer db.Close()
+
+			err := migrate(context.Background(), db)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, fake.migrationsUp())
+			for _, m := range migrations {
+				assert.True(t, fake.isApplied(m.version), "migration %d must be recorded", m.version)
+			}
+			assert.Equal(t, len(migrations), fake.commits+fake.rollbacks)
+		})
+	}
+}
+
+func Test_migrate_FailedMigrationRollsBack(t *testing.T) {
+	fake := newFakeDB(1)
+	fake.failOn = "ALTER TABLE metrics RENAME TO metrics_legacy"
+	db := fake.open()
+	defer db.Close()
+
+	err := migrate(context.Background(), db)
+	require.ErrorIs(t, err, errFakeQuery)
+	assert.Contains(t, err.Error(), "migration 3")
+	assert.Equal(t, []string{migrations[1].name, migrations[2].name}, fake.migrationsUp())
+	assert.True(t, fake.isApplied(2))
+	assert.False(t, fake.isApplied(3), "failed migration mustn't be recorded")
+	assert.Equal(t, 1, fake.commits)
+	assert.Equal(t, 2, fake.rollbacks)
+
+	// The next start retries the failed migration only.
+	fake.failOn = ""
+	fake.executed = nil
+	err = migrate(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{migrations[2].name, migrations[3].name}, fake.migrationsUp())
+	assert.True(t, fake.isApplied(4))
+}
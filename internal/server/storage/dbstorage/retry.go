@@ -0,0 +1,66 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// withRetry runs op and repeats it with exponential backoff while it fails
+// with a transient error, retries are left and ctx isn't done.
+func (s *DBStorage) withRetry(ctx context.Context, op func() error) error {
+	backoff := s.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= s.opts.Retries || !isTransient(err) {
+			return err
+		}
+
+		log.Ctx(ctx).Warn().Err(err).Int("attempt", attempt+1).Dur("backoff", backoff).Msg("transient database error; retrying")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether the query failed because of the connection
+// problem or concurrent transactions and may succeed if repeated.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P03": // cannot_connect_now
+			return true
+		}
+		return pqErr.Code.Class() == "08" // connection_exception
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isForeignKeyViolation reports whether the query failed because the row it
+// refers to doesn't exist.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,64 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, want: true},
+		{name: "connection exception", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "unique violation", err: &pq.Error{Code: "23505"}, want: false},
+		{name: "no rows", err: sql.ErrNoRows, want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTransient(tt.err))
+		})
+	}
+}
+
+func TestDBStorage_withRetry(t *testing.T) {
+	s := &DBStorage{opts: Options{Retries: 2}}
+
+	attempts := 0
+	err := s.withRetry(context.Background(), func() error {
+		attempts++
+		return syscall.ECONNREFUSED
+	})
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = s.withRetry(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	err = s.withRetry(context.Background(), func() error {
+		attempts++
+		return errors.New("permanent")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownBackend     = errors.New("unknown storage backend")
+	ErrBackendUnavailable = errors.New("storage backend is unavailable")
+)
+
+// BackendError is returned when the registered backend can't be created.
+type BackendError struct {
+	Backend string
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("storage backend %q: %v", e.Backend, e.Err)
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// unavailableError is the error of connecting to or opening the backend.
+// It matches both ErrBackendUnavailable and the error of the backend.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrBackendUnavailable, e.err)
+}
+
+func (e *unavailableError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// unavailable marks the error of connecting to or opening the backend, so
+// the fallback backend may be used instead. Other errors, e.g. mistakes in
+// the config, are returned as is.
+func unavailable(err error) error {
+	return &unavailableError{err: err}
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+// failoverStorage wraps the backend which may become unreachable at runtime.
+// While the backend is unreachable writes are buffered in memory; they are
+// replayed as soon as the backend reports it is connected again. The backend
+// is never called under the lock of the buffer, so a slow backend doesn't
+// serialize requests.
+type failoverStorage struct {
+	primary failoverBackend
+
+	mu          sync.Mutex
+	gauges      map[string]metrics.Gauge
+	counterSets map[string]metrics.Counter
+	counterAdds map[string]metrics.Counter
+
+	// replayMu prevents the timer and Close from replaying simultaneously.
+	replayMu  sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// failoverBackend is the backend which increments counters atomically, so
+// buffered increments are replayed without reading counters which may fail
+// while the backend is still flapping.
+type failoverBackend interface {
+	InnerStorage
+	counterAdder
+}
+
+const defaultFailoverCheckInterval = 1 * time.Second
+
+// failoverCheckTimeout limits the check whether the backend is reachable
+// after a failed write.
+const failoverCheckTimeout = 1 * time.Second
+
+func newFailoverStorage(primary failoverBackend, checkInterval time.Duration) *failoverStorage {
+	if checkInterval <= 0 {
+		checkInterval = defaultFailoverCheckInterval
+	}
+
+	res := &failoverStorage{
+		primary:     primary,
+		gauges:      map[string]metrics.Gauge{},
+		counterSets: map[string]metrics.Counter{},
+		counterAdds: map[string]metrics.Counter{},
+		done:        make(chan struct{}),
+	}
+
+	go res.replayByTimer(checkInterval)
+
+	return res
+}
+
+func (s *failoverStorage) Unwrap() InnerStorage {
+	return s.primary
+}
+
+func (s *failoverStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	if !s.buffering() {
+		err := s.primary.SetGaugeMetrics(ctx, name, val)
+		if !s.isUnreachable(ctx, err) {
+			return err
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("storage is unreachable; buffering writes")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[name] = val
+	return nil
+}
+
+func (s *failoverStorage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
+	s.mu.Lock()
+	val, ok := s.gauges[name]
+	s.mu.Unlock()
+	if ok {
+		return val, true
+	}
+
+	return s.primary.GetGaugeMetrics(ctx, name)
+}
+
+func (s *failoverStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	if !s.buffering() {
+		err := s.primary.SetCounterMetrics(ctx, name, val)
+		if !s.isUnreachable(ctx, err) {
+			return err
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("storage is unreachable; buffering writes")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counterSets[name] = val
+	delete(s.counterAdds, name)
+	return nil
+}
+
+func (s *failoverStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	if !s.buffering() {
+		err := s.primary.AddCounterMetrics(ctx, name, delta)
+		if !s.isUnreachable(ctx, err) {
+			return err
+		}
+		log.Ctx(ctx).Error().Err(err).Msg("storage is unreachable; buffering writes")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.counterSets[name]; ok {
+		s.counterSets[name] += delta
+	} else {
+		s.counterAdds[name] += delta
+	}
+	return nil
+}
+
+// GetCounterMetrics returns the value of the counter with buffered changes
+// applied. While the backend is unreachable a counter whose value is known
+// only by the backend isn't found: buffered increments alone aren't its value.
+func (s *failoverStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	s.mu.Lock()
+	set, isSet := s.counterSets[name]
+	added := s.counterAdds[name]
+	s.mu.Unlock()
+	if isSet {
+		return set, true
+	}
+
+	val, ok := s.primary.GetCounterMetrics(ctx, name)
+	if !ok {
+		return 0, false
+	}
+	return val + added, true
+}
+
+func (s *failoverStorage) GetKnownMetrics(ctx context.Context) []string {
+	known := map[string]struct{}{}
+	for _, name := range s.primary.GetKnownMetrics(ctx) {
+		known[name] = struct{}{}
+	}
+
+	s.mu.Lock()
+	for name := range s.gauges {
+		known[name] = struct{}{}
+	}
+	for name := range s.counterSets {
+		known[name] = struct{}{}
+	}
+	for name := range s.counterAdds {
+		known[name] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	var res []string
+	for name := range known {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *failoverStorage) IsDBConnected(ctx context.Context) bool {
+	return s.primary.IsDBConnected(ctx)
+}
+
+// Close makes the last attempt to replay buffered changes and closes
+// the backend. Changes which failed to be replayed are lost.
+func (s *failoverStorage) Close() error {
+	err := errors.New("storage is already closed")
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.replay(context.Background())
+
+		if s.buffering() {
+			log.Error().Msg("storage is unreachable; buffered writes are lost")
+		}
+		err = s.primary.Close()
+	})
+	return err
+}
+
+func (s *failoverStorage) replayByTimer(checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.replay(context.Background())
+		}
+	}
+}
+
+// replay writes buffered changes to the backend if it is connected. The
+// changes are taken from the snapshot of the buffer, and a change is removed
+// from the buffer only if it wasn't changed again while it was written.
+// Changes which failed to be written stay in the buffer.
+func (s *failoverStorage) replay(ctx context.Context) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	if !s.buffering() || !s.isConnected() {
+		return
+	}
+
+	s.mu.Lock()
+	gauges := copyGauges(s.gauges)
+	counterSets := copyCounters(s.counterSets)
+	counterAdds := copyCounters(s.counterAdds)
+	s.mu.Unlock()
+
+	log.Ctx(ctx).Info().Msg("storage is reachable; replaying buffered writes")
+	for name, val := range gauges {
+		if err := s.primary.SetGaugeMetrics(ctx, name, val); err != nil {
+			log.Ctx(ctx).Error().Err(err).Stack()
+			return
+		}
+		s.mu.Lock()
+		if s.gauges[name] == val {
+			delete(s.gauges, name)
+		}
+		s.mu.Unlock()
+	}
+	for name, val := range counterSets {
+		if err := s.primary.SetCounterMetrics(ctx, name, val); err != nil {
+			log.Ctx(ctx).Error().Err(err).Stack()
+			return
+		}
+		s.mu.Lock()
+		if current, ok := s.counterSets[name]; ok && current == val {
+			delete(s.counterSets, name)
+		}
+		s.mu.Unlock()
+	}
+	for name, delta := range counterAdds {
+		if err := s.primary.AddCounterMetrics(ctx, name, delta); err != nil {
+			log.Ctx(ctx).Error().Err(err).Stack()
+			return
+		}
+		s.mu.Lock()
+		if _, ok := s.counterAdds[name]; ok {
+			// Increments buffered meanwhile are replayed next time.
+			s.counterAdds[name] -= delta
+			if s.counterAdds[name] == 0 {
+				delete(s.counterAdds, name)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// buffering reports whether there are buffered changes. New writes are
+// buffered until all previous ones are replayed to keep their order.
+func (s *failoverStorage) buffering() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.gauges) > 0 || len(s.counterSets) > 0 || len(s.counterAdds) > 0
+}
+
+// isUnreachable reports whether the write failed with err because the backend
+// is unreachable. A write interrupted by the caller isn't buffered, and the
+// backend is checked regardless of the caller's context.
+func (s *failoverStorage) isUnreachable(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return false
+	}
+	return !s.isConnected()
+}
+
+func (s *failoverStorage) isConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), failoverCheckTimeout)
+	defer cancel()
+	return s.primary.IsDBConnected(ctx)
+}
+
+func copyGauges(m map[string]metrics.Gauge) map[string]metrics.Gauge {
+	res := make(map[string]metrics.Gauge, len(m))
+	for name, val := range m {
+		res[name] = val
+	}
+	return res
+}
+
+func copyCounters(m map[string]metrics.Counter) map[string]metrics.Counter {
+	res := make(map[string]metrics.Counter, len(m))
+	for name, val := range m {
+		res[name] = val
+	}
+	return res
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/inmemorystorage"
+)
+
+// unreliableStorage is in-memory storage which may be switched off or fail
+// writes of gauges with the given error. Like a database, it fails requests
+// whose context is done.
+type unreliableStorage struct {
+	*inmemorystorage.InMemoryStorage
+	down    bool
+	failErr error
+}
+
+var errStorageDown = errors.New("storage is down")
+
+func (s *unreliableStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	if s.down {
+		return errStorageDown
+	}
+	if s.failErr != nil {
+		return s.failErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.InMemoryStorage.SetGaugeMetrics(ctx, name, val)
+}
+
+func (s *unreliableStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	if s.down {
+		return errStorageDown
+	}
+	return s.InMemoryStorage.SetCounterMetrics(ctx, name, val)
+}
+
+func (s *unreliableStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	if s.down {
+		return 0, false
+	}
+	return s.InMemoryStorage.GetCounterMetrics(ctx, name)
+}
+
+func (s *unreliableStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	if s.down {
+		return errStorageDown
+	}
+	val, _ := s.InMemoryStorage.GetCounterMetrics(ctx, name)
+	return s.InMemoryStorage.SetCounterMetrics(ctx, name, val+delta)
+}
+
+func (s *unreliableStorage) IsDBConnected(ctx context.Context) bool {
+	return !s.down && ctx.Err() == nil
+}
+
+func newUnreliableStorage() *unreliableStorage {
+	return &unreliableStorage{
+		InMemoryStorage: &inmemorystorage.InMemoryStorage{Metrics: metrics.Metrics{
+			GaugeMetrics:   map[string]metrics.Gauge{},
+			CounterMetrics: map[string]metrics.Counter{},
+		}},
+	}
+}
+
+// slowStorage blocks writes of the gauge named Slow until it's released.
+type slowStorage struct {
+	*unreliableStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	if name == "Slow" {
+		close(s.started)
+		<-s.release
+	}
+	return s.unreliableStorage.SetGaugeMetrics(ctx, name, val)
+}
+
+func Test_failoverStorage_BufferAndReplay(t *testing.T) {
+	primary := &unreliableStorage{
+		InMemoryStorage: &inmemorystorage.InMemoryStorage{Metrics: metrics.Metrics{
+			GaugeMetrics:   map[string]metrics.Gauge{},
+			CounterMetrics: map[string]metrics.Counter{},
+		}},
+	}
+	s := newFailoverStorage(primary, time.Hour)
+
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 5))
+
+	primary.down = true
+	require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", 1.5))
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 3))
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 2))
+
+	gauge, ok := s.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Gauge(1.5), gauge)
+	_, ok = primary.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.False(t, ok)
+
+	s.replay(context.Background())
+	assert.True(t, s.buffering())
+
+	primary.down = false
+	s.replay(context.Background())
+	assert.False(t, s.buffering())
+
+	gauge, ok = primary.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Gauge(1.5), gauge)
+	counter, ok := primary.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(10), counter)
+}
+
+func Test_failoverStorage_BufferOnlyWhenUnreachable(t *testing.T) {
+	errQuery := errors.New("query failed")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		down         bool
+		failErr      error
+		wantErr      error
+		wantBuffered bool
+	}{
+		{name: "storage is down", ctx: context.Background(), down: true, wantBuffered: true},
+		{name: "query failed", ctx: context.Background(), failErr: errQuery, wantErr: errQuery},
+		{name: "request canceled", ctx: canceled, wantErr: context.Canceled},
+		{name: "query failed after request canceled", ctx: canceled, failErr: errQuery, wantErr: errQuery},
+		{name: "storage is down after request canceled", ctx: canceled, down: true, wantBuffered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &unreliableStorage{
+				InMemoryStorage: &inmemorystorage.InMemoryStorage{Metrics: metrics.Metrics{
+					GaugeMetrics:   map[string]metrics.Gauge{},
+					CounterMetrics: map[string]metrics.Counter{},
+				}},
+				down:    tt.down,
+				failErr: tt.failErr,
+			}
+			s := newFailoverStorage(primary, time.Hour)
+
+			err := s.SetGaugeMetrics(tt.ctx, "TestGauge", 1.5)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantBuffered, s.buffering())
+		})
+	}
+}
+
+func Test_failoverStorage_SlowBackendDoesntBlockRequests(t *testing.T) {
+	primary := &slowStorage{
+		unreliableStorage: newUnreliableStorage(),
+		started:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	s := newFailoverStorage(primary, time.Hour)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- s.SetGaugeMetrics(context.Background(), "Slow", 1)
+	}()
+	<-primary.started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, s.SetGaugeMetrics(context.Background(), "Fast", 2))
+		_, ok := s.GetGaugeMetrics(context.Background(), "Fast")
+		assert.True(t, ok)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("requests wait for the slow write")
+	}
+
+	close(primary.release)
+	assert.NoError(t, <-slowDone)
+	<-done
+}
+
+func Test_failoverStorage_CounterUnknownWhileBuffering(t *testing.T) {
+	primary := newUnreliableStorage()
+	s := newFailoverStorage(primary, time.Hour)
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 5))
+
+	primary.down = true
+	require.NoError(t, s.AddCounterMetrics(context.Background(), "TestCounter", 3))
+	_, ok := s.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.False(t, ok, "buffered increments alone aren't the value of the counter")
+
+	primary.down = false
+	counter, ok := s.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(8), counter)
+
+	s.replay(context.Background())
+	assert.False(t, s.buffering())
+	counter, ok = primary.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(8), counter)
+}
@@ -0,0 +1,232 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+var (
+	gaugeBucket   = []byte("gauge")
+	counterBucket = []byte("counter")
+	historyBucket = []byte("history")
+)
+
+var (
+	ErrNoPath          = errors.New("file storage path isn't set")
+	ErrCantOpenStorage = errors.New("can't open file storage")
+)
+
+// Sample is a value of the metric saved at the specific moment. Counter is
+// the value of the counter, not the increment.
+type Sample struct {
+	Time    time.Time
+	Gauge   metrics.Gauge
+	Counter metrics.Counter
+}
+
+// FileStorage keeps metrics in the embedded on-disk key-value store.
+// Along with current values it keeps the history of every metric
+// for the retention period.
+type FileStorage struct {
+	path      string
+	retention time.Duration
+	db        *bolt.DB
+}
+
+func New(path string, retention time.Duration) (*FileStorage, error) {
+	log.Debug().Msg("FileStorage started")
+	if len(path) == 0 {
+		return nil, ErrNoPath
+	}
+
+	var res = &FileStorage{
+		path:      path,
+		retention: retention,
+	}
+
+	var err error
+	res.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, ErrCantOpenStorage
+	}
+
+	err = res.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{gaugeBucket, counterBucket, historyBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Stack()
+		res.db.Close()
+		return nil, ErrCantOpenStorage
+	}
+
+	return res, nil
+}
+
+func (s *FileStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("SetCounterMetrics started")
+	err := s.put(counterBucket, name, uint64(val))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+	}
+	return err
+}
+
+func (s *FileStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	val, ok := s.get(counterBucket, name)
+	return metrics.Counter(val), ok
+}
+
+func (s *FileStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	log.Ctx(ctx).Debug().Msg("SetGaugeMetrics started")
+	err := s.put(gaugeBucket, name, math.Float64bits(float64(val)))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+	}
+	return err
+}
+
+func (s *FileStorage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
+	val, ok := s.get(gaugeBucket, name)
+	return metrics.Gauge(math.Float64frombits(val)), ok
+}
+
+func (s *FileStorage) GetKnownMetrics(ctx context.Context) []string {
+	var res []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{counterBucket, gaugeBucket} {
+			err := tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+				res = append(res, string(k))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+	}
+	return res
+}
+
+func (s *FileStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *FileStorage) IsDBConnected(ctx context.Context) bool {
+	return false
+}
+
+// GaugeHistory returns saved values of the gauge metric since the given moment.
+func (s *FileStorage) GaugeHistory(name string, since time.Time) ([]Sample, error) {
+	var res []Sample
+	err := s.history(gaugeBucket, name, since, func(ts time.Time, val uint64) {
+		res = append(res, Sample{Time: ts, Gauge: metrics.Gauge(math.Float64frombits(val))})
+	})
+	return res, err
+}
+
+// CounterHistory returns saved values of the counter metric since the given moment.
+func (s *FileStorage) CounterHistory(name string, since time.Time) ([]Sample, error) {
+	var res []Sample
+	err := s.history(counterBucket, name, since, func(ts time.Time, val uint64) {
+		res = append(res, Sample{Time: ts, Counter: metrics.Counter(val)})
+	})
+	return res, err
+}
+
+func (s *FileStorage) put(bucket []byte, name string, val uint64) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucket).Put([]byte(name), encode(val))
+		if err != nil {
+			return err
+		}
+
+		if s.retention <= 0 {
+			return nil
+		}
+
+		series, err := tx.Bucket(historyBucket).CreateBucketIfNotExists(seriesKey(bucket, name))
+		if err != nil {
+			return err
+		}
+
+		err = series.Put(encode(uint64(now.UnixNano())), encode(val))
+		if err != nil {
+			return err
+		}
+
+		cutoff := encode(uint64(now.Add(-s.retention).UnixNano()))
+		var expired [][]byte
+		c := series.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := series.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *FileStorage) get(bucket []byte, name string) (uint64, bool) {
+	var res uint64
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(bucket).Get([]byte(name))
+		if val == nil {
+			return nil
+		}
+		res, ok = binary.BigEndian.Uint64(val), true
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return 0, false
+	}
+	return res, ok
+}
+
+func (s *FileStorage) history(bucket []byte, name string, since time.Time, fn func(time.Time, uint64)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		series := tx.Bucket(historyBucket).Bucket(seriesKey(bucket, name))
+		if series == nil {
+			return nil
+		}
+
+		c := series.Cursor()
+		for k, v := c.Seek(encode(uint64(since.UnixNano()))); k != nil; k, v = c.Next() {
+			fn(time.Unix(0, int64(binary.BigEndian.Uint64(k))), binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+}
+
+func seriesKey(bucket []byte, name string) []byte {
+	return []byte(string(bucket) + ":" + name)
+}
+
+func encode(val uint64) []byte {
+	res := make([]byte, 8)
+	binary.BigEndian.PutUint64(res, val)
+	return res
+}
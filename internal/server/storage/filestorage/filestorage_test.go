@@ -0,0 +1,78 @@
+package filestorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+func TestFileStorage_SetGetMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s, err := New(path, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", 1.5))
+	require.NoError(t, s.SetCounterMetrics(context.Background(), "TestCounter", 10))
+
+	gauge, ok := s.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Gauge(1.5), gauge)
+
+	counter, ok := s.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(10), counter)
+
+	_, ok = s.GetGaugeMetrics(context.Background(), "Unknown")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"TestCounter", "TestGauge"}, s.GetKnownMetrics(context.Background()))
+}
+
+func TestFileStorage_Durability(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s, err := New(path, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.SetCounterMetrics(context.Background(), "TestCounter", 5))
+	require.NoError(t, s.db.Close())
+
+	reopened, err := New(path, time.Hour)
+	require.NoError(t, err)
+	counter, ok := reopened.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(5), counter)
+}
+
+func TestFileStorage_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s, err := New(path, time.Hour)
+	require.NoError(t, err)
+
+	since := time.Now()
+	for _, val := range []metrics.Gauge{1, 2, 3} {
+		require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", val))
+	}
+
+	history, err := s.GaugeHistory("TestGauge", since)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, metrics.Gauge(1), history[0].Gauge)
+	assert.Equal(t, metrics.Gauge(3), history[2].Gauge)
+
+	history, err = s.CounterHistory("TestGauge", since)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	require.NoError(t, s.SetCounterMetrics(context.Background(), "TestCounter", 2))
+	require.NoError(t, s.SetCounterMetrics(context.Background(), "TestCounter", 5))
+	history, err = s.CounterHistory("TestCounter", since)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, metrics.Counter(2), history[0].Counter)
+	assert.Equal(t, metrics.Counter(5), history[1].Counter)
+}
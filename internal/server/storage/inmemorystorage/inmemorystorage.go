@@ -1,9 +1,14 @@
 package inmemorystorage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
-	"runtime"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,17 +17,30 @@ import (
 	"github.com/nivanov045/metrics-monitor/internal/metrics"
 )
 
+// snapshotTimeLayout is used in names of rotated snapshot files,
+// e.g. devops-metrics-db.20221019T120000.000Z.json.
+const snapshotTimeLayout = "20060102T150405.000Z"
+
 type InMemoryStorage struct {
 	Metrics       metrics.Metrics
 	storeInterval time.Duration
 	storeFile     string
+	storeKeep     int
 	restore       bool
+	restoreFrom   string
 	hasUpdates    bool
 	syncSave      bool
 	mu            sync.Mutex
+	done          chan struct{}
+	closeOnce     sync.Once
 }
 
-func New(storeInterval time.Duration, storeFile string, restore bool) *InMemoryStorage {
+// New creates in-memory storage. If storeKeep is positive, every save creates
+// a new timestamped snapshot next to storeFile and only storeKeep latest
+// snapshots are kept; otherwise storeFile is overwritten. If restoreFrom is
+// set, metrics are restored from this snapshot regardless of restore, and
+// the storage isn't created if the snapshot can't be read.
+func New(storeInterval time.Duration, storeFile string, restore bool, restoreFrom string, storeKeep int) (*InMemoryStorage, error) {
 	var res = &InMemoryStorage{
 		Metrics: metrics.Metrics{
 			GaugeMetrics:   map[string]metrics.Gauge{},
@@ -30,26 +48,33 @@ func New(storeInterval time.Duration, storeFile string, restore bool) *InMemoryS
 		},
 		storeInterval: storeInterval,
 		storeFile:     storeFile,
+		storeKeep:     storeKeep,
 		restore:       restore,
+		restoreFrom:   restoreFrom,
 		hasUpdates:    false,
 		syncSave:      false,
 	}
 
-	if restore {
+	if len(restoreFrom) > 0 {
+		err := res.restoreFromFile()
+		if err != nil {
+			return nil, fmt.Errorf("can't restore metrics from %q: %w", restoreFrom, err)
+		}
+	} else if restore {
 		res.doRestore()
 	}
-	runtime.SetFinalizer(res, func(s *InMemoryStorage) {
-		log.Debug().Msg("StorageFinalizer started")
-		s.doSave()
-	})
 
 	if res.storeInterval > 0*time.Second {
+		res.done = make(chan struct{})
 		go res.saveByTimer()
 	} else {
 		res.syncSave = true
+		if storeKeep > 0 {
+			log.Warn().Int("keep", storeKeep).Msg("metrics are saved on every update, so snapshots cover only the latest updates")
+		}
 	}
 
-	return res
+	return res, nil
 }
 
 func (s *InMemoryStorage) doRestore() {
@@ -62,7 +87,16 @@ func (s *InMemoryStorage) doRestore() {
 func (s *InMemoryStorage) restoreFromFile() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	file, err := os.OpenFile(s.storeFile, os.O_RDONLY|os.O_CREATE, 0777)
+
+	path := s.restorePath()
+	log.Info().Str("path", path).Msg("restoring metrics")
+	// The explicitly requested snapshot must exist, the store file is
+	// created on the first start.
+	flag := os.O_RDONLY | os.O_CREATE
+	if len(s.restoreFrom) > 0 {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(path, flag, 0777)
 	if err != nil {
 		log.Error().Err(err).Stack()
 		return err
@@ -80,44 +114,55 @@ func (s *InMemoryStorage) restoreFromFile() error {
 	return nil
 }
 
-func (s *InMemoryStorage) SetCounterMetrics(name string, val metrics.Counter) error {
-	log.Debug().Msg("SetCounterMetrics started")
+func (s *InMemoryStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("SetCounterMetrics started")
+	s.mu.Lock()
 	s.Metrics.CounterMetrics[name] = val
+	s.hasUpdates = true
+	s.mu.Unlock()
+
 	if s.syncSave {
 		s.doSave()
-	} else {
-		s.hasUpdates = true
 	}
 
 	return nil
 }
 
-func (s *InMemoryStorage) GetCounterMetrics(name string) (metrics.Counter, bool) {
+func (s *InMemoryStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if val, ok := s.Metrics.CounterMetrics[name]; ok {
 		return val, true
 	}
 	return 0, false
 }
 
-func (s *InMemoryStorage) SetGaugeMetrics(name string, val metrics.Gauge) error {
-	log.Debug().Msg("SetGaugeMetrics started")
+func (s *InMemoryStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	log.Ctx(ctx).Debug().Msg("SetGaugeMetrics started")
+	s.mu.Lock()
 	s.Metrics.GaugeMetrics[name] = val
+	s.hasUpdates = true
+	s.mu.Unlock()
+
 	if s.syncSave {
 		s.doSave()
-	} else {
-		s.hasUpdates = true
 	}
 	return nil
 }
 
-func (s *InMemoryStorage) GetGaugeMetrics(name string) (metrics.Gauge, bool) {
+func (s *InMemoryStorage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if val, ok := s.Metrics.GaugeMetrics[name]; ok {
 		return val, true
 	}
 	return 0, false
 }
 
-func (s *InMemoryStorage) GetKnownMetrics() []string {
+func (s *InMemoryStorage) GetKnownMetrics(ctx context.Context) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	var res []string
 	for key := range s.Metrics.CounterMetrics {
 		res = append(res, key)
@@ -130,13 +175,30 @@ func (s *InMemoryStorage) GetKnownMetrics() []string {
 
 func (s *InMemoryStorage) saveByTimer() {
 	ticker := time.NewTicker(s.storeInterval)
+	defer ticker.Stop()
 	for {
-		<-ticker.C
-		log.Debug().Msg("saveByTimer ticker")
-		s.doSave()
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			log.Debug().Msg("saveByTimer ticker")
+			s.doSave()
+		}
 	}
 }
 
+// Close stops saving by timer and flushes metrics to the file.
+func (s *InMemoryStorage) Close() error {
+	err := errors.New("storage is already closed")
+	s.closeOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+		}
+		err = s.saveToFile()
+	})
+	return err
+}
+
 func (s *InMemoryStorage) doSave() {
 	err := s.saveToFile()
 	if err != nil {
@@ -154,7 +216,12 @@ func (s *InMemoryStorage) saveToFile() error {
 		return nil
 	}
 
-	file, err := os.OpenFile(s.storeFile, os.O_WRONLY|os.O_CREATE, 0777)
+	path := s.storeFile
+	if s.storeKeep > 0 {
+		path = s.snapshotPath(time.Now())
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
 		log.Error().Err(err).Stack()
 		return err
@@ -171,9 +238,73 @@ func (s *InMemoryStorage) saveToFile() error {
 
 	s.hasUpdates = false
 
+	if s.storeKeep > 0 {
+		s.pruneSnapshots()
+	}
+
 	return nil
 }
 
-func (s *InMemoryStorage) IsDBConnected() bool {
+// restorePath returns the file to restore metrics from: the explicitly
+// requested snapshot, the latest rotated snapshot or the store file.
+func (s *InMemoryStorage) restorePath() string {
+	if len(s.restoreFrom) > 0 {
+		return s.restoreFrom
+	}
+
+	if s.storeKeep > 0 {
+		if snapshots := s.listSnapshots(); len(snapshots) > 0 {
+			return snapshots[len(snapshots)-1]
+		}
+	}
+
+	return s.storeFile
+}
+
+func (s *InMemoryStorage) snapshotPath(t time.Time) string {
+	ext := filepath.Ext(s.storeFile)
+	base := strings.TrimSuffix(s.storeFile, ext)
+	return base + "." + t.UTC().Format(snapshotTimeLayout) + ext
+}
+
+// listSnapshots returns paths of existing snapshots from the oldest to the latest.
+func (s *InMemoryStorage) listSnapshots() []string {
+	ext := filepath.Ext(s.storeFile)
+	base := strings.TrimSuffix(s.storeFile, ext)
+
+	candidates, err := filepath.Glob(base + ".*" + ext)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil
+	}
+
+	var res []string
+	for _, path := range candidates {
+		ts := strings.TrimSuffix(strings.TrimPrefix(path, base+"."), ext)
+		if _, err := time.Parse(snapshotTimeLayout, ts); err != nil {
+			continue
+		}
+		res = append(res, path)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func (s *InMemoryStorage) pruneSnapshots() {
+	snapshots := s.listSnapshots()
+	if len(snapshots) <= s.storeKeep {
+		return
+	}
+
+	for _, path := range snapshots[:len(snapshots)-s.storeKeep] {
+		log.Debug().Str("path", path).Msg("removing old snapshot")
+		if err := os.Remove(path); err != nil {
+			log.Error().Err(err).Stack()
+		}
+	}
+}
+
+func (s *InMemoryStorage) IsDBConnected(ctx context.Context) bool {
 	return false
 }
@@ -0,0 +1,73 @@
+package inmemorystorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+func TestInMemoryStorage_RotateSnapshots(t *testing.T) {
+	storeFile := filepath.Join(t.TempDir(), "devops-metrics-db.json")
+	s, err := New(0*time.Second, storeFile, false, "", 2)
+	require.NoError(t, err)
+
+	for i := 1; i <= 4; i++ {
+		err := s.SetCounterMetrics(context.Background(), "TestCounter", metrics.Counter(i))
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	snapshots := s.listSnapshots()
+	assert.Len(t, snapshots, 2)
+
+	restored, err := New(0*time.Second, storeFile, true, "", 2)
+	require.NoError(t, err)
+	val, ok := restored.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(4), val)
+
+	fromOlder, err := New(0*time.Second, storeFile, false, snapshots[0], 2)
+	require.NoError(t, err)
+	val, ok = fromOlder.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(3), val)
+}
+
+func TestInMemoryStorage_SingleStoreFile(t *testing.T) {
+	storeFile := filepath.Join(t.TempDir(), "devops-metrics-db.json")
+	s, err := New(0*time.Second, storeFile, false, "", 0)
+	require.NoError(t, err)
+
+	err = s.SetGaugeMetrics(context.Background(), "TestGauge", 12.5)
+	require.NoError(t, err)
+	assert.Empty(t, s.listSnapshots())
+
+	restored, err := New(0*time.Second, storeFile, true, "", 0)
+	require.NoError(t, err)
+	val, ok := restored.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Gauge(12.5), val)
+}
+
+func TestInMemoryStorage_RestoreFromMissingOrBrokenSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	storeFile := filepath.Join(dir, "devops-metrics-db.json")
+
+	missing := filepath.Join(dir, "devops-metrics-db.typo.json")
+	_, err := New(0*time.Second, storeFile, true, missing, 2)
+	assert.Error(t, err)
+	_, statErr := os.Stat(missing)
+	assert.True(t, os.IsNotExist(statErr), "missing snapshot must not be created")
+
+	broken := filepath.Join(dir, "devops-metrics-db.broken.json")
+	require.NoError(t, os.WriteFile(broken, []byte("{"), 0600))
+	_, err = New(0*time.Second, storeFile, true, broken, 2)
+	assert.Error(t, err)
+}
@@ -1,12 +1,29 @@
 package storage
 
-import "github.com/nivanov045/metrics-monitor/internal/metrics"
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
 
 type InnerStorage interface {
-	SetGaugeMetrics(name string, val metrics.Gauge) error
-	GetGaugeMetrics(name string) (metrics.Gauge, bool)
-	SetCounterMetrics(name string, val metrics.Counter) error
-	GetCounterMetrics(name string) (metrics.Counter, bool)
-	GetKnownMetrics() []string
-	IsDBConnected() bool
+	SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error
+	GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool)
+	SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error
+	GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool)
+	GetKnownMetrics(ctx context.Context) []string
+	IsDBConnected(ctx context.Context) bool
+	Close() error
+}
+
+// counterAdder is implemented by backends which can increment counters
+// atomically, e.g. when several servers share the backend.
+type counterAdder interface {
+	AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error
+}
+
+// poolStatsProvider is implemented by backends with a connection pool.
+type poolStatsProvider interface {
+	Stats() sql.DBStats
 }
@@ -0,0 +1,182 @@
+package redisstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+// Gauges are kept in one hash, every counter is kept in its own key to be
+// incremented atomically, names of counters are kept in a set.
+const (
+	gaugesKey        = "metrics:gauges"
+	countersKey      = "metrics:counters"
+	counterKeyPrefix = "metrics:counter:"
+)
+
+var (
+	ErrWrongAddress = errors.New("wrong redis address")
+	ErrCantConnect  = errors.New("can't connect to redis")
+)
+
+type RedisStorage struct {
+	client *redis.Client
+}
+
+// New connects to the Redis-protocol server. The address is either
+// host:port or redis:// URL.
+func New(address string) (*RedisStorage, error) {
+	log.Debug().Msg("RedisStorage started")
+	if len(address) == 0 {
+		return nil, ErrWrongAddress
+	}
+
+	options := &redis.Options{Addr: address}
+	if strings.Contains(address, "://") {
+		var err error
+		options, err = redis.ParseURL(address)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return nil, fmt.Errorf("%w: %v", ErrWrongAddress, err)
+		}
+	}
+
+	var res = &RedisStorage{client: redis.NewClient(options)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := res.client.Ping(ctx).Err(); err != nil {
+		log.Error().Err(err).Stack()
+		res.client.Close()
+		return nil, ErrCantConnect
+	}
+
+	return res, nil
+}
+
+func (s *RedisStorage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("SetCounterMetrics started")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, counterKeyPrefix+name, int64(val), 0)
+		pipe.SAdd(ctx, countersKey, name)
+		return nil
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return err
+	}
+
+	return nil
+}
+
+// AddCounterMetrics atomically increments the counter, so several servers
+// can share it.
+func (s *RedisStorage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	log.Ctx(ctx).Debug().Msg("AddCounterMetrics started")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, counterKeyPrefix+name, int64(delta))
+		pipe.SAdd(ctx, countersKey, name)
+		return nil
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return err
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	value, err := s.client.Get(ctx, counterKeyPrefix+name).Int64()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Ctx(ctx).Error().Err(err).Stack()
+		}
+		return 0, false
+	}
+
+	return metrics.Counter(value), true
+}
+
+func (s *RedisStorage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	log.Ctx(ctx).Debug().Msg("SetGaugeMetrics started")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := s.client.HSet(ctx, gaugesKey, name, float64(val)).Err()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return err
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	value, err := s.client.HGet(ctx, gaugesKey, name).Float64()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Ctx(ctx).Error().Err(err).Stack()
+		}
+		return 0, false
+	}
+
+	return metrics.Gauge(value), true
+}
+
+func (s *RedisStorage) GetKnownMetrics(ctx context.Context) []string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	counters, err := s.client.SMembers(ctx, countersKey).Result()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return nil
+	}
+
+	gauges, err := s.client.HKeys(ctx, gaugesKey).Result()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Stack()
+		return nil
+	}
+
+	sort.Strings(counters)
+	sort.Strings(gauges)
+
+	var res []string
+	res = append(res, counters...)
+	res = append(res, gauges...)
+	return res
+}
+
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStorage) IsDBConnected(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return s.client.Ping(ctx).Err() == nil
+}
@@ -0,0 +1,64 @@
+package redisstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/metrics"
+)
+
+func TestRedisStorage_SetGetMetrics(t *testing.T) {
+	server := miniredis.RunT(t)
+	s, err := New(server.Addr())
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetGaugeMetrics(context.Background(), "TestGauge", 1.5))
+	require.NoError(t, s.SetCounterMetrics(context.Background(), "TestCounter", 10))
+
+	gauge, ok := s.GetGaugeMetrics(context.Background(), "TestGauge")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Gauge(1.5), gauge)
+
+	counter, ok := s.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(10), counter)
+
+	_, ok = s.GetCounterMetrics(context.Background(), "Unknown")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"TestCounter", "TestGauge"}, s.GetKnownMetrics(context.Background()))
+	assert.True(t, s.IsDBConnected(context.Background()))
+}
+
+func TestRedisStorage_SharedCounter(t *testing.T) {
+	server := miniredis.RunT(t)
+	first, err := New(server.Addr())
+	require.NoError(t, err)
+	second, err := New("redis://" + server.Addr() + "/0")
+	require.NoError(t, err)
+
+	require.NoError(t, first.AddCounterMetrics(context.Background(), "TestCounter", 5))
+	require.NoError(t, second.AddCounterMetrics(context.Background(), "TestCounter", 7))
+
+	counter, ok := first.GetCounterMetrics(context.Background(), "TestCounter")
+	assert.True(t, ok)
+	assert.Equal(t, metrics.Counter(12), counter)
+	assert.Equal(t, []string{"TestCounter"}, second.GetKnownMetrics(context.Background()))
+}
+
+func TestRedisStorage_Unavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	address := server.Addr()
+	s, err := New(address)
+	require.NoError(t, err)
+
+	server.Close()
+	assert.False(t, s.IsDBConnected(context.Background()))
+
+	_, err = New(address)
+	assert.ErrorIs(t, err, ErrCantConnect)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nivanov045/metrics-monitor/internal/server/config"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/dbstorage"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/filestorage"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/inmemorystorage"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/redisstorage"
+)
+
+const (
+	MemoryBackend   = "memory"
+	FileBackend     = "file"
+	PostgresBackend = "postgres"
+	RedisBackend    = "redis"
+
+	// NoFallback disables falling back to another backend.
+	NoFallback = "none"
+)
+
+// Factory creates inner storage of the backend from the server config.
+type Factory func(config config.Config) (InnerStorage, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Factory{}
+)
+
+// Register makes the backend available by the name. It panics if the backend
+// with the same name is already registered.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("storage: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends returns sorted names of registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	var res []string
+	for name := range backends {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func newBackend(name string, config config.Config) (InnerStorage, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+
+	res, err := factory(config)
+	if err != nil {
+		return nil, &BackendError{Backend: name, Err: err}
+	}
+	return res, nil
+}
+
+// backendName returns the configured backend or chooses it by the config
+// as earlier versions did: postgres if DSN is set, redis if its address is
+// set, file if its path is set, memory otherwise.
+func backendName(config config.Config) string {
+	switch {
+	case len(config.StorageBackend) > 0:
+		return config.StorageBackend
+	case len(config.Database) > 0:
+		return PostgresBackend
+	case len(config.Redis) > 0:
+		return RedisBackend
+	case len(config.FileStorage) > 0:
+		return FileBackend
+	default:
+		return MemoryBackend
+	}
+}
+
+func init() {
+	Register(MemoryBackend, func(config config.Config) (InnerStorage, error) {
+		s, err := inmemorystorage.New(config.StoreInterval, config.StoreFile, config.Restore, config.RestoreFrom, config.StoreKeep)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+	Register(FileBackend, func(config config.Config) (InnerStorage, error) {
+		s, err := filestorage.New(config.FileStorage, config.FileRetention)
+		if errors.Is(err, filestorage.ErrCantOpenStorage) {
+			return nil, unavailable(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+	Register(PostgresBackend, func(config config.Config) (InnerStorage, error) {
+		s, err := dbstorage.New(config.Database, dbstorage.Options{
+			MaxOpenConns:     config.DBMaxOpenConns,
+			MaxIdleConns:     config.DBMaxIdleConns,
+			ConnMaxLifetime:  config.DBConnMaxLifetime,
+			QueryTimeout:     config.DBQueryTimeout,
+			Retries:          config.DBRetries,
+			RetryBackoff:     config.DBRetryBackoff,
+			SamplesRetention: config.DBSamplesRetention,
+		})
+		if errors.Is(err, dbstorage.ErrCantCreateDatabase) {
+			return nil, unavailable(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+	Register(RedisBackend, func(config config.Config) (InnerStorage, error) {
+		s, err := redisstorage.New(config.Redis)
+		if errors.Is(err, redisstorage.ErrCantConnect) {
+			return nil, unavailable(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nivanov045/metrics-monitor/internal/server/config"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/dbstorage"
+	"github.com/nivanov045/metrics-monitor/internal/server/storage/inmemorystorage"
+)
+
+func Test_backendName(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.Config
+		want   string
+	}{
+		{
+			name:   "explicit backend",
+			config: config.Config{StorageBackend: FileBackend, Database: "dsn"},
+			want:   FileBackend,
+		},
+		{
+			name:   "database dsn",
+			config: config.Config{Database: "dsn", FileStorage: "/tmp/metrics.db"},
+			want:   PostgresBackend,
+		},
+		{
+			name:   "file storage path",
+			config: config.Config{FileStorage: "/tmp/metrics.db"},
+			want:   FileBackend,
+		},
+		{
+			name:   "default",
+			config: config.Config{},
+			want:   MemoryBackend,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, backendName(tt.config))
+		})
+	}
+}
+
+func Test_New_UnknownBackend(t *testing.T) {
+	_, err := New(config.Config{StorageBackend: "unknown", StorageFallback: MemoryBackend})
+	assert.True(t, errors.Is(err, ErrUnknownBackend))
+}
+
+func Test_New_Fallback(t *testing.T) {
+	cfg := config.Config{
+		StoreInterval:   0 * time.Second,
+		StoreFile:       t.TempDir() + "/devops-metrics-db.json",
+		StorageBackend:  PostgresBackend,
+		Database:        "postgres://127.0.0.1:1/metrics?sslmode=disable",
+		StorageFallback: MemoryBackend,
+	}
+
+	s, err := New(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &inmemorystorage.InMemoryStorage{}, s.innerStorage)
+
+	cfg.StorageFallback = NoFallback
+	_, err = New(cfg)
+	assert.True(t, errors.Is(err, ErrBackendUnavailable))
+	assert.True(t, errors.Is(err, dbstorage.ErrCantCreateDatabase))
+	var backendErr *BackendError
+	require.True(t, errors.As(err, &backendErr))
+	assert.Equal(t, PostgresBackend, backendErr.Backend)
+}
+
+func Test_New_ConfigErrorsDontFallBack(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.Config
+	}{
+		{
+			name:   "file without path",
+			config: config.Config{StorageBackend: FileBackend},
+		},
+		{
+			name:   "postgres without dsn",
+			config: config.Config{StorageBackend: PostgresBackend},
+		},
+		{
+			name:   "malformed redis url",
+			config: config.Config{StorageBackend: RedisBackend, Redis: "redis://127.0.0.1:6379/not-a-db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.StoreFile = t.TempDir() + "/devops-metrics-db.json"
+			tt.config.StorageFallback = MemoryBackend
+
+			_, err := New(tt.config)
+			require.Error(t, err)
+			assert.False(t, errors.Is(err, ErrBackendUnavailable))
+			var backendErr *BackendError
+			assert.True(t, errors.As(err, &backendErr))
+		})
+	}
+}
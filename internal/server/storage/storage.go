@@ -1,56 +1,104 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
 	_ "github.com/lib/pq"
+	"github.com/rs/zerolog/log"
 
 	"github.com/nivanov045/metrics-monitor/internal/metrics"
 	"github.com/nivanov045/metrics-monitor/internal/server/config"
-	"github.com/nivanov045/metrics-monitor/internal/server/storage/dbstorage"
-	"github.com/nivanov045/metrics-monitor/internal/server/storage/inmemorystorage"
 )
 
 type storage struct {
 	innerStorage InnerStorage
+	counterMu    sync.Mutex
 }
 
+// New creates storage with the configured backend. If the backend is
+// unavailable, the fallback backend is used unless fallback is disabled.
+// If failover is enabled, writes to the database backend which becomes
+// unreachable later are buffered in memory until it is back.
 func New(config config.Config) (*storage, error) {
-	var res = &storage{}
-	var err error
-	if len(config.Database) > 0 {
-		res.innerStorage, err = dbstorage.New(config.Database)
-		return res, err
+	name := backendName(config)
+	inner, err := newBackend(name, config)
+	if err == nil {
+		if backend, ok := inner.(failoverBackend); ok && config.StorageFailover && inner.IsDBConnected(context.Background()) {
+			inner = newFailoverStorage(backend, config.FailoverCheckInterval)
+		}
+		return &storage{innerStorage: inner}, nil
+	}
+
+	fallback := config.StorageFallback
+	if !errors.Is(err, ErrBackendUnavailable) || len(fallback) == 0 || fallback == NoFallback || fallback == name {
+		return nil, err
+	}
+
+	log.Error().Err(err).Str("fallback", fallback).Msg("storage backend is unavailable; using fallback")
+	inner, err = newBackend(fallback, config)
+	if err != nil {
+		return nil, err
 	}
 
-	res.innerStorage = inmemorystorage.New(config.StoreInterval, config.StoreFile, config.Restore)
-	return res, err
+	return &storage{innerStorage: inner}, nil
 }
 
-func (s *storage) SetCounterMetrics(name string, val metrics.Counter) error {
-	return s.innerStorage.SetCounterMetrics(name, val)
+func (s *storage) SetCounterMetrics(ctx context.Context, name string, val metrics.Counter) error {
+	return s.innerStorage.SetCounterMetrics(ctx, name, val)
 }
 
-func (s *storage) GetCounterMetrics(name string) (metrics.Counter, bool) {
-	return s.innerStorage.GetCounterMetrics(name)
+// AddCounterMetrics increments the counter by delta. The counter is created
+// if it isn't known yet.
+func (s *storage) AddCounterMetrics(ctx context.Context, name string, delta metrics.Counter) error {
+	if adder, ok := s.innerStorage.(counterAdder); ok {
+		return adder.AddCounterMetrics(ctx, name, delta)
+	}
+
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
+
+	exVal, _ := s.innerStorage.GetCounterMetrics(ctx, name)
+	return s.innerStorage.SetCounterMetrics(ctx, name, exVal+delta)
 }
 
-func (s *storage) SetGaugeMetrics(name string, val metrics.Gauge) error {
-	return s.innerStorage.SetGaugeMetrics(name, val)
+func (s *storage) GetCounterMetrics(ctx context.Context, name string) (metrics.Counter, bool) {
+	return s.innerStorage.GetCounterMetrics(ctx, name)
 }
 
-func (s *storage) GetGaugeMetrics(name string) (metrics.Gauge, bool) {
-	return s.innerStorage.GetGaugeMetrics(name)
+func (s *storage) SetGaugeMetrics(ctx context.Context, name string, val metrics.Gauge) error {
+	return s.innerStorage.SetGaugeMetrics(ctx, name, val)
 }
 
-func (s *storage) GetKnownMetrics() []string {
-	return s.innerStorage.GetKnownMetrics()
+func (s *storage) GetGaugeMetrics(ctx context.Context, name string) (metrics.Gauge, bool) {
+	return s.innerStorage.GetGaugeMetrics(ctx, name)
 }
 
-func (s *storage) IsDBConnected() bool {
-	return s.innerStorage.IsDBConnected()
+func (s *storage) GetKnownMetrics(ctx context.Context) []string {
+	return s.innerStorage.GetKnownMetrics(ctx)
 }
 
-func NewForcedInMemory(config config.Config) *storage {
-	var res = &storage{}
-	res.innerStorage = inmemorystorage.New(config.StoreInterval, config.StoreFile, config.Restore)
-	return res
+func (s *storage) IsDBConnected(ctx context.Context) bool {
+	return s.innerStorage.IsDBConnected(ctx)
+}
+
+// Close flushes buffered data and releases resources of the backend.
+func (s *storage) Close() error {
+	return s.innerStorage.Close()
+}
+
+// PoolStats returns statistics of the connection pool if the backend has one.
+func (s *storage) PoolStats() (sql.DBStats, bool) {
+	inner := s.innerStorage
+	if wrapper, ok := inner.(interface{ Unwrap() InnerStorage }); ok {
+		inner = wrapper.Unwrap()
+	}
+
+	provider, ok := inner.(poolStatsProvider)
+	if !ok {
+		return sql.DBStats{}, false
+	}
+	return provider.Stats(), true
 }
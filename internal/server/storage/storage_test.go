@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -34,9 +35,9 @@ func Test_storage_SetGetCounterMetrics(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.SetCounterMetrics(tt.args.name, tt.args.val)
+			err := s.SetCounterMetrics(context.Background(), tt.args.name, tt.args.val)
 			assert.NoError(t, err)
-			val, ok := s.GetCounterMetrics(tt.args.name)
+			val, ok := s.GetCounterMetrics(context.Background(), tt.args.name)
 			if !ok || tt.args.val != val {
 				t.Errorf("storage.SetCounterMetrics() error with name %v, val %v", tt.args.name, tt.args.val)
 			}
@@ -69,9 +70,9 @@ func Test_storage_SetGetGaugeMetrics(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.SetGaugeMetrics(tt.args.name, tt.args.val)
+			err := s.SetGaugeMetrics(context.Background(), tt.args.name, tt.args.val)
 			assert.NoError(t, err)
-			val, ok := s.GetGaugeMetrics(tt.args.name)
+			val, ok := s.GetGaugeMetrics(context.Background(), tt.args.name)
 			if !ok || tt.args.val != val {
 				t.Errorf("storage.SetCounterMetrics() error with name %v, val %v", tt.args.name, tt.args.val)
 			}
@@ -118,7 +119,7 @@ func Test_storage_GetKnownMetrics(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.s.GetKnownMetrics(), tt.want)
+			assert.Equal(t, tt.s.GetKnownMetrics(context.Background()), tt.want)
 		})
 	}
 }